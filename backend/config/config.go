@@ -0,0 +1,644 @@
+// Package config loads the server configuration from an optional YAML file and environment variables.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PlaceholderJWTSecret is the development secret that must never be used in production
+const PlaceholderJWTSecret = "your_secret_key"
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Policies for accounts whose email address has not been verified
+const (
+	EmailPolicyAllow    = "allow"    // Sign in normally
+	EmailPolicyRestrict = "restrict" // Sign in with only email_verification.unverified_roles
+	EmailPolicyBlock    = "block"    // Refuse sign-in
+)
+
+// Config holds all runtime settings for the server
+type Config struct {
+	Environment       string                  `yaml:"environment"`
+	AppURL            string                  `yaml:"app_url"` // Frontend base URL used in email links and redirects
+	Server            ServerConfig            `yaml:"server"`
+	Database          DatabaseConfig          `yaml:"database"`
+	JWT               JWTConfig               `yaml:"jwt"`
+	Google            GoogleConfig            `yaml:"google"`
+	OIDC              OIDCConfig              `yaml:"oidc"`
+	Mail              MailConfig              `yaml:"mail"`
+	Auth              AuthConfig              `yaml:"auth"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	PasswordPolicy    PasswordPolicyConfig    `yaml:"password_policy"`
+	Login             LoginConfig             `yaml:"login"`
+	MFA               MFAConfig               `yaml:"mfa"`
+	WebAuthn          WebAuthnConfig          `yaml:"webauthn"`
+	RateLimit         RateLimitConfig         `yaml:"rate_limit"`
+	Users             UsersConfig             `yaml:"users"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Addr           string   `yaml:"addr"`
+	PublicURL      string   `yaml:"public_url"`      // Externally reachable base URL of the API, used for OAuth redirect URLs
+	TrustedProxies []string `yaml:"trusted_proxies"` // Proxies whose X-Forwarded-For is believed when rate limiting by client IP
+}
+
+// DatabaseConfig holds database settings
+type DatabaseConfig struct {
+	Path string `yaml:"path"`
+}
+
+// JWTConfig holds token signing settings
+type JWTConfig struct {
+	Secret              string        `yaml:"secret"`    // Encrypts signing keys at rest and signs internal tokens
+	Algorithm           string        `yaml:"algorithm"` // RS256 or EdDSA
+	Issuer              string        `yaml:"issuer"`
+	AccessTokenTTL      time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL     time.Duration `yaml:"refresh_token_ttl"`
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval"` // How long a signing key stays current
+	KeyRetirementGrace  time.Duration `yaml:"key_retirement_grace"`  // How long a retired key is still published for verification
+}
+
+// Supported access token signing algorithms
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// GoogleConfig holds Google OAuth client settings
+type GoogleConfig struct {
+	ClientID     string        `yaml:"client_id"`
+	ClientSecret string        `yaml:"client_secret"`
+	RedirectURL  string        `yaml:"redirect_url"`
+	JWKSURL      string        `yaml:"jwks_url"`   // Keys used to verify Google ID tokens locally
+	ClockSkew    time.Duration `yaml:"clock_skew"` // Leeway allowed on ID token timestamps
+}
+
+// OIDCConfig holds the OpenID Connect providers users can sign in with, besides Google
+type OIDCConfig struct {
+	ClockSkew time.Duration                 `yaml:"clock_skew"` // Leeway allowed on ID token timestamps
+	Providers map[string]OIDCProviderConfig `yaml:"providers"`  // Keyed by the name used in /auth/oidc/:provider routes
+}
+
+// OIDCProviderConfig holds one OpenID Connect provider's client settings
+type OIDCProviderConfig struct {
+	DisplayName  string   `yaml:"display_name"`
+	Issuer       string   `yaml:"issuer"` // Endpoints are discovered from <issuer>/.well-known/openid-configuration
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"` // Also read from MIS_OIDC_<NAME>_CLIENT_SECRET
+	Scopes       []string `yaml:"scopes"`
+	RedirectURL  string   `yaml:"redirect_url"` // Defaults to <server.public_url>/api/v1/auth/oidc/<name>/callback
+	TrustEmail   bool     `yaml:"trust_email"`  // Treat emails as verified when the provider sends no email_verified claim
+}
+
+// MailConfig holds outbound email settings
+type MailConfig struct {
+	Backend  string `yaml:"backend"` // smtp, file or noop
+	From     string `yaml:"from"`
+	Dir      string `yaml:"dir"` // Output directory for the file backend
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// AuthConfig holds authentication flow settings
+type AuthConfig struct {
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	InviteTTL        time.Duration `yaml:"invite_ttl"`      // Lifetime of invitation links sent to admin-created users
+	LinkTicketTTL    time.Duration `yaml:"link_ticket_ttl"` // Lifetime of tickets linking a verified Google account at registration
+	OAuthStateTTL    time.Duration `yaml:"oauth_state_ttl"` // How long a user has to complete sign-in at an identity provider
+	LoginCodeTTL     time.Duration `yaml:"login_code_ttl"`  // Lifetime of the one-time code the SPA exchanges for tokens after OAuth sign-in
+	RedirectURIs     []string      `yaml:"redirect_uris"`   // SPA pages OAuth sign-in may hand off to; defaults to <app_url>/auth/callback
+}
+
+// EmailVerificationConfig holds settings for confirming that users own their email address
+type EmailVerificationConfig struct {
+	Policy          string        `yaml:"policy"`           // allow, restrict or block sign-in until the email is verified
+	TokenTTL        time.Duration `yaml:"token_ttl"`        // Lifetime of verification links
+	UnverifiedRoles []string      `yaml:"unverified_roles"` // Roles unverified users keep under the restrict policy
+}
+
+// PasswordPolicyConfig holds the rules new passwords must satisfy
+type PasswordPolicyConfig struct {
+	MinLength        int           `yaml:"min_length"`
+	MaxLength        int           `yaml:"max_length"` // At most 72, the longest password bcrypt accepts
+	RequireUppercase bool          `yaml:"require_uppercase"`
+	RequireLowercase bool          `yaml:"require_lowercase"`
+	RequireDigit     bool          `yaml:"require_digit"`
+	RequireSymbol    bool          `yaml:"require_symbol"`
+	History          int           `yaml:"history"`            // Previous passwords that may not be reused; 0 allows reuse
+	MaxAge           time.Duration `yaml:"max_age"`            // Passwords older than this must be changed at sign-in; 0 never expires them
+	CheckBreached    bool          `yaml:"check_breached"`     // Reject passwords found in the breached password list
+	BreachedListFile string        `yaml:"breached_list_file"` // Extra breached passwords or SHA-1 hashes, one per line, added to the bundled list
+}
+
+// LoginConfig holds brute-force protection settings for password login.
+// Failures are counted per account and per client IP.
+type LoginConfig struct {
+	FreeAttempts    int           `yaml:"free_attempts"`    // Failures per account allowed before backoff starts
+	BackoffBase     time.Duration `yaml:"backoff_base"`     // Wait after the first throttled failure, doubling with each further failure
+	BackoffMax      time.Duration `yaml:"backoff_max"`      // Upper bound of the backoff wait
+	AccountLockout  int           `yaml:"account_lockout"`  // Failures that lock an account; 0 disables account lockout
+	IPLockout       int           `yaml:"ip_lockout"`       // Failures that lock out a client IP; 0 disables IP lockout
+	LockoutDuration time.Duration `yaml:"lockout_duration"` // How long a lockout lasts unless an administrator lifts it
+	FailureWindow   time.Duration `yaml:"failure_window"`   // Counters reset after this long without a failure
+}
+
+// MFAConfig holds two-factor authentication settings
+type MFAConfig struct {
+	Issuer        string        `yaml:"issuer"`         // Account name prefix shown in authenticator apps
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl"`  // How long a user has to enter a code after the first factor
+	RecoveryCodes int           `yaml:"recovery_codes"` // Recovery codes generated per user
+	Skew          int           `yaml:"skew"`           // 30 second steps a code may be early or late
+}
+
+// WebAuthnConfig holds passkey settings
+type WebAuthnConfig struct {
+	RPID    string        `yaml:"rp_id"`   // Domain passkeys are bound to; must be the host of every web origin or a parent domain
+	RPName  string        `yaml:"rp_name"` // Shown by the authenticator
+	Origins []string      `yaml:"origins"` // Web and android:apk-key-hash: origins allowed to use passkeys; defaults to app_url
+	Timeout time.Duration `yaml:"timeout"` // How long a user has to complete a passkey prompt
+}
+
+// RateLimitConfig holds request rate limits.
+// Policies are token buckets applied per route group; a policy set in the config file replaces the default as a whole.
+type RateLimitConfig struct {
+	Store    string                     `yaml:"store"` // memory, or sql to share limits between processes through the database
+	Policies map[string]RateLimitPolicy `yaml:"policies"`
+}
+
+// RateLimitPolicy allows Burst requests at once, refilled at Requests per Per, counted per Key
+type RateLimitPolicy struct {
+	Requests int           `yaml:"requests"` // 0 disables the policy
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"` // Defaults to requests
+	Key      string        `yaml:"key"`   // ip, user or device
+}
+
+// rateLimitKeys are the ways a policy can count requests
+var rateLimitKeys = []string{"ip", "user", "device"}
+
+// UsersConfig holds user lifecycle settings
+type UsersConfig struct {
+	DeletedEmailGrace time.Duration `yaml:"deleted_email_grace"` // How long a deleted account's email stays reserved
+}
+
+// providerNamePattern restricts OIDC provider names to what can appear in a URL path and an env var
+var providerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Default returns the development configuration
+func Default() *Config {
+	return &Config{
+		Environment: EnvDevelopment,
+		AppURL:      "http://localhost:5173",
+		Server: ServerConfig{
+			Addr:           ":8080",
+			PublicURL:      "http://localhost:8080",
+			TrustedProxies: []string{"127.0.0.1", "::1"},
+		},
+		Database: DatabaseConfig{
+			Path: "mis.db",
+		},
+		JWT: JWTConfig{
+			Secret:              PlaceholderJWTSecret,
+			Algorithm:           AlgorithmRS256,
+			Issuer:              "mis-system",
+			AccessTokenTTL:      15 * time.Minute,
+			RefreshTokenTTL:     30 * 24 * time.Hour,
+			KeyRotationInterval: 30 * 24 * time.Hour,
+			KeyRetirementGrace:  24 * time.Hour,
+		},
+		Google: GoogleConfig{
+			ClientID:     "your-google-client-id",
+			ClientSecret: "your-google-client-secret",
+			RedirectURL:  "http://localhost:8080/api/v1/auth/google/callback",
+			JWKSURL:      "https://www.googleapis.com/oauth2/v3/certs",
+			ClockSkew:    time.Minute,
+		},
+		OIDC: OIDCConfig{
+			ClockSkew: time.Minute,
+		},
+		Mail: MailConfig{
+			Backend: "file",
+			From:    "UESS <no-reply@localhost>",
+			Dir:     "outbox",
+			Port:    587,
+		},
+		Auth: AuthConfig{
+			PasswordResetTTL: time.Hour,
+			InviteTTL:        72 * time.Hour,
+			LinkTicketTTL:    10 * time.Minute,
+			OAuthStateTTL:    10 * time.Minute,
+			LoginCodeTTL:     time.Minute,
+		},
+		EmailVerification: EmailVerificationConfig{
+			Policy:          EmailPolicyAllow,
+			TokenTTL:        48 * time.Hour,
+			UnverifiedRoles: []string{"user"},
+		},
+		PasswordPolicy: PasswordPolicyConfig{
+			MinLength:     8,
+			MaxLength:     72,
+			History:       5,
+			CheckBreached: true,
+		},
+		Login: LoginConfig{
+			FreeAttempts:    3,
+			BackoffBase:     time.Second,
+			BackoffMax:      5 * time.Minute,
+			AccountLockout:  10,
+			IPLockout:       100,
+			LockoutDuration: 15 * time.Minute,
+			FailureWindow:   time.Hour,
+		},
+		MFA: MFAConfig{
+			Issuer:        "UESS",
+			ChallengeTTL:  5 * time.Minute,
+			RecoveryCodes: 10,
+			Skew:          1,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:    "localhost",
+			RPName:  "UESS",
+			Timeout: 5 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Store: "memory",
+			Policies: map[string]RateLimitPolicy{
+				"login":           {Requests: 10, Per: time.Minute, Burst: 20, Key: "ip"},
+				"register":        {Requests: 5, Per: time.Hour, Key: "ip"},
+				"forgot_password": {Requests: 5, Per: 15 * time.Minute, Key: "ip"},
+				"reset_password":  {Requests: 10, Per: 15 * time.Minute, Key: "ip"},
+				"refresh":         {Requests: 60, Per: time.Minute, Key: "ip"},
+				"oauth":           {Requests: 30, Per: time.Minute, Key: "ip"},
+				"verify_email":    {Requests: 10, Per: 15 * time.Minute, Key: "ip"},
+				"mfa":             {Requests: 10, Per: time.Minute, Key: "ip"},
+				"passkey":         {Requests: 20, Per: time.Minute, Key: "ip"},
+				"api":             {Requests: 600, Per: time.Minute, Burst: 100, Key: "user"},
+			},
+		},
+		Users: UsersConfig{
+			DeletedEmailGrace: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the optional YAML file at path and environment variables, in that order
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// IsProduction reports whether the server runs in production mode
+func (c *Config) IsProduction() bool {
+	return c.Environment == EnvProduction
+}
+
+// WebAuthnOrigins returns the origins allowed to use passkeys, defaulting to the frontend's origin
+func (c *Config) WebAuthnOrigins() []string {
+	if len(c.WebAuthn.Origins) > 0 {
+		return c.WebAuthn.Origins
+	}
+	return []string{strings.TrimSuffix(c.AppURL, "/")}
+}
+
+// Validate checks the configuration for missing or unsafe values
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Environment {
+	case EnvDevelopment, EnvProduction:
+	default:
+		errs = append(errs, fmt.Errorf("environment must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Environment))
+	}
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, errors.New("database.path is required"))
+	}
+	if c.AppURL == "" {
+		errs = append(errs, errors.New("app_url is required"))
+	}
+
+	if c.JWT.Secret == "" {
+		errs = append(errs, errors.New("jwt.secret is required"))
+	}
+	if c.IsProduction() {
+		if c.JWT.Secret == PlaceholderJWTSecret {
+			errs = append(errs, errors.New("jwt.secret must be changed from the placeholder value in production"))
+		} else if len(c.JWT.Secret) < 32 {
+			errs = append(errs, errors.New("jwt.secret must be at least 32 characters in production"))
+		}
+	}
+	switch c.JWT.Algorithm {
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		errs = append(errs, fmt.Errorf("jwt.algorithm must be %s or %s, got %q", AlgorithmRS256, AlgorithmEdDSA, c.JWT.Algorithm))
+	}
+	if c.JWT.Issuer == "" {
+		errs = append(errs, errors.New("jwt.issuer is required"))
+	}
+	if c.JWT.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("jwt.access_token_ttl must be positive"))
+	}
+	if c.JWT.RefreshTokenTTL <= c.JWT.AccessTokenTTL {
+		errs = append(errs, errors.New("jwt.refresh_token_ttl must be longer than jwt.access_token_ttl"))
+	}
+	if c.JWT.KeyRotationInterval <= 0 {
+		errs = append(errs, errors.New("jwt.key_rotation_interval must be positive"))
+	}
+	if c.JWT.KeyRetirementGrace < c.JWT.AccessTokenTTL {
+		errs = append(errs, errors.New("jwt.key_retirement_grace must be at least jwt.access_token_ttl"))
+	}
+
+	if c.Google.JWKSURL == "" {
+		errs = append(errs, errors.New("google.jwks_url is required"))
+	}
+	if c.Google.ClockSkew < 0 || c.Google.ClockSkew > 5*time.Minute {
+		errs = append(errs, errors.New("google.clock_skew must be between 0 and 5m"))
+	}
+
+	if c.OIDC.ClockSkew < 0 || c.OIDC.ClockSkew > 5*time.Minute {
+		errs = append(errs, errors.New("oidc.clock_skew must be between 0 and 5m"))
+	}
+	for name, provider := range c.OIDC.Providers {
+		if !providerNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("oidc.providers: invalid provider name %q", name))
+		} else if name == "google" {
+			errs = append(errs, errors.New("oidc.providers: google is configured in the google section"))
+		}
+		if provider.Issuer == "" {
+			errs = append(errs, fmt.Errorf("oidc.providers.%s.issuer is required", name))
+		}
+		if provider.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc.providers.%s.client_id is required", name))
+		}
+	}
+	if c.Server.PublicURL == "" {
+		errs = append(errs, errors.New("server.public_url is required"))
+	} else if c.IsProduction() && !strings.HasPrefix(c.Server.PublicURL, "https://") {
+		errs = append(errs, errors.New("server.public_url must use https in production"))
+	}
+
+	if c.Auth.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("auth.password_reset_ttl must be positive"))
+	}
+	if c.Auth.InviteTTL <= 0 {
+		errs = append(errs, errors.New("auth.invite_ttl must be positive"))
+	}
+	if c.Auth.LinkTicketTTL <= 0 {
+		errs = append(errs, errors.New("auth.link_ticket_ttl must be positive"))
+	}
+	if c.Auth.OAuthStateTTL <= 0 {
+		errs = append(errs, errors.New("auth.oauth_state_ttl must be positive"))
+	}
+	if c.Auth.LoginCodeTTL <= 0 || c.Auth.LoginCodeTTL > 5*time.Minute {
+		errs = append(errs, errors.New("auth.login_code_ttl must be between 0 and 5m"))
+	}
+	for _, uri := range c.Auth.RedirectURIs {
+		if u, err := url.Parse(uri); err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			errs = append(errs, fmt.Errorf("auth.redirect_uris: %q must be an absolute URL without a fragment", uri))
+		}
+	}
+	switch c.EmailVerification.Policy {
+	case EmailPolicyAllow, EmailPolicyRestrict, EmailPolicyBlock:
+	default:
+		errs = append(errs, fmt.Errorf("email_verification.policy must be %s, %s or %s, got %q",
+			EmailPolicyAllow, EmailPolicyRestrict, EmailPolicyBlock, c.EmailVerification.Policy))
+	}
+	if c.EmailVerification.TokenTTL <= 0 {
+		errs = append(errs, errors.New("email_verification.token_ttl must be positive"))
+	}
+
+	if c.PasswordPolicy.MinLength < 1 {
+		errs = append(errs, errors.New("password_policy.min_length must be positive"))
+	}
+	if c.PasswordPolicy.MaxLength < c.PasswordPolicy.MinLength || c.PasswordPolicy.MaxLength > 72 {
+		errs = append(errs, errors.New("password_policy.max_length must be between password_policy.min_length and 72"))
+	}
+	if c.PasswordPolicy.History < 0 || c.PasswordPolicy.History > 24 {
+		errs = append(errs, errors.New("password_policy.history must be between 0 and 24"))
+	}
+	if c.PasswordPolicy.MaxAge < 0 {
+		errs = append(errs, errors.New("password_policy.max_age must not be negative"))
+	}
+
+	if c.Login.FreeAttempts < 0 {
+		errs = append(errs, errors.New("login.free_attempts must not be negative"))
+	}
+	if c.Login.BackoffBase <= 0 || c.Login.BackoffMax < c.Login.BackoffBase {
+		errs = append(errs, errors.New("login.backoff_base must be positive and at most login.backoff_max"))
+	}
+	if c.Login.AccountLockout < 0 || c.Login.IPLockout < 0 {
+		errs = append(errs, errors.New("login.account_lockout and login.ip_lockout must not be negative"))
+	}
+	if c.Login.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("login.lockout_duration must be positive"))
+	}
+	if c.Login.FailureWindow <= 0 {
+		errs = append(errs, errors.New("login.failure_window must be positive"))
+	}
+
+	if c.MFA.Issuer == "" || strings.Contains(c.MFA.Issuer, ":") {
+		errs = append(errs, errors.New("mfa.issuer is required and must not contain ':'"))
+	}
+	if c.MFA.ChallengeTTL <= 0 || c.MFA.ChallengeTTL > 15*time.Minute {
+		errs = append(errs, errors.New("mfa.challenge_ttl must be positive and at most 15m"))
+	}
+	if c.MFA.RecoveryCodes < 1 || c.MFA.RecoveryCodes > 50 {
+		errs = append(errs, errors.New("mfa.recovery_codes must be between 1 and 50"))
+	}
+	if c.MFA.Skew < 0 || c.MFA.Skew > 3 {
+		errs = append(errs, errors.New("mfa.skew must be between 0 and 3"))
+	}
+
+	if c.WebAuthn.RPID == "" || c.WebAuthn.RPName == "" {
+		errs = append(errs, errors.New("webauthn.rp_id and webauthn.rp_name are required"))
+	}
+	for _, origin := range c.WebAuthnOrigins() {
+		if strings.HasPrefix(origin, "android:apk-key-hash:") {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" || u.Path != "" || (u.Scheme != "https" && u.Scheme != "http") {
+			errs = append(errs, fmt.Errorf("webauthn.origins: %q must be a scheme and host, or android:apk-key-hash:<hash>", origin))
+			continue
+		}
+		if host := u.Hostname(); host != c.WebAuthn.RPID && !strings.HasSuffix(host, "."+c.WebAuthn.RPID) {
+			errs = append(errs, fmt.Errorf("webauthn.origins: %q is not within webauthn.rp_id %q", origin, c.WebAuthn.RPID))
+		}
+		if c.IsProduction() && u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("webauthn.origins: %q must use https in production", origin))
+		}
+	}
+	if c.WebAuthn.Timeout <= 0 || c.WebAuthn.Timeout > 10*time.Minute {
+		errs = append(errs, errors.New("webauthn.timeout must be positive and at most 10m"))
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "sql" {
+		errs = append(errs, fmt.Errorf("rate_limit.store must be memory or sql, got %q", c.RateLimit.Store))
+	}
+	for name, policy := range c.RateLimit.Policies {
+		if policy.Requests < 0 || policy.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s: requests and burst must not be negative", name))
+		}
+		if policy.Requests > 0 && policy.Per <= 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s.per must be positive", name))
+		}
+		if !slices.Contains(rateLimitKeys, policy.Key) {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s.key must be ip, user or device, got %q", name, policy.Key))
+		}
+	}
+
+	if c.Users.DeletedEmailGrace < 0 {
+		errs = append(errs, errors.New("users.deleted_email_grace must not be negative"))
+	}
+
+	switch c.Mail.Backend {
+	case "smtp":
+		if c.Mail.Host == "" {
+			errs = append(errs, errors.New("mail.host is required for the smtp backend"))
+		}
+		if c.Mail.Port <= 0 {
+			errs = append(errs, errors.New("mail.port must be positive for the smtp backend"))
+		}
+	case "file":
+		if c.Mail.Dir == "" {
+			errs = append(errs, errors.New("mail.dir is required for the file backend"))
+		}
+	case "noop":
+	default:
+		errs = append(errs, fmt.Errorf("mail.backend must be smtp, file or noop, got %q", c.Mail.Backend))
+	}
+	if c.Mail.Backend != "noop" && c.Mail.From == "" {
+		errs = append(errs, errors.New("mail.from is required"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// applyEnv overrides configuration values with MIS_* environment variables
+func (c *Config) applyEnv() error {
+	strs := map[string]*string{
+		"MIS_ENV":                       &c.Environment,
+		"MIS_APP_URL":                   &c.AppURL,
+		"MIS_LISTEN_ADDR":               &c.Server.Addr,
+		"MIS_PUBLIC_URL":                &c.Server.PublicURL,
+		"MIS_DATABASE_PATH":             &c.Database.Path,
+		"MIS_JWT_SECRET":                &c.JWT.Secret,
+		"MIS_JWT_ALGORITHM":             &c.JWT.Algorithm,
+		"MIS_JWT_ISSUER":                &c.JWT.Issuer,
+		"MIS_GOOGLE_CLIENT_ID":          &c.Google.ClientID,
+		"MIS_GOOGLE_CLIENT_SECRET":      &c.Google.ClientSecret,
+		"MIS_GOOGLE_REDIRECT_URL":       &c.Google.RedirectURL,
+		"MIS_GOOGLE_JWKS_URL":           &c.Google.JWKSURL,
+		"MIS_MAIL_BACKEND":              &c.Mail.Backend,
+		"MIS_MAIL_FROM":                 &c.Mail.From,
+		"MIS_MAIL_DIR":                  &c.Mail.Dir,
+		"MIS_SMTP_HOST":                 &c.Mail.Host,
+		"MIS_SMTP_USERNAME":             &c.Mail.Username,
+		"MIS_SMTP_PASSWORD":             &c.Mail.Password,
+		"MIS_RATE_LIMIT_STORE":          &c.RateLimit.Store,
+		"MIS_MFA_ISSUER":                &c.MFA.Issuer,
+		"MIS_EMAIL_VERIFICATION_POLICY": &c.EmailVerification.Policy,
+		"MIS_WEBAUTHN_RP_ID":            &c.WebAuthn.RPID,
+		"MIS_BREACHED_PASSWORDS_FILE":   &c.PasswordPolicy.BreachedListFile,
+	}
+	for key, dst := range strs {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = strings.TrimSpace(v)
+		}
+	}
+
+	// Provider secrets are best kept out of the config file
+	for name, provider := range c.OIDC.Providers {
+		if v, ok := os.LookupEnv("MIS_OIDC_" + strings.ToUpper(name) + "_CLIENT_SECRET"); ok {
+			provider.ClientSecret = strings.TrimSpace(v)
+			c.OIDC.Providers[name] = provider
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"MIS_ACCESS_TOKEN_TTL":       &c.JWT.AccessTokenTTL,
+		"MIS_REFRESH_TOKEN_TTL":      &c.JWT.RefreshTokenTTL,
+		"MIS_KEY_ROTATION_INTERVAL":  &c.JWT.KeyRotationInterval,
+		"MIS_KEY_RETIREMENT_GRACE":   &c.JWT.KeyRetirementGrace,
+		"MIS_PASSWORD_RESET_TTL":     &c.Auth.PasswordResetTTL,
+		"MIS_INVITE_TTL":             &c.Auth.InviteTTL,
+		"MIS_OAUTH_STATE_TTL":        &c.Auth.OAuthStateTTL,
+		"MIS_LOGIN_CODE_TTL":         &c.Auth.LoginCodeTTL,
+		"MIS_EMAIL_VERIFICATION_TTL": &c.EmailVerification.TokenTTL,
+		"MIS_PASSWORD_MAX_AGE":       &c.PasswordPolicy.MaxAge,
+		"MIS_LOGIN_LOCKOUT_DURATION": &c.Login.LockoutDuration,
+		"MIS_MFA_CHALLENGE_TTL":      &c.MFA.ChallengeTTL,
+		"MIS_DELETED_EMAIL_GRACE":    &c.Users.DeletedEmailGrace,
+	}
+	for key, dst := range durations {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*dst = d
+		}
+	}
+
+	ints := map[string]*int{
+		"MIS_SMTP_PORT":             &c.Mail.Port,
+		"MIS_LOGIN_ACCOUNT_LOCKOUT": &c.Login.AccountLockout,
+		"MIS_LOGIN_IP_LOCKOUT":      &c.Login.IPLockout,
+		"MIS_PASSWORD_MIN_LENGTH":   &c.PasswordPolicy.MinLength,
+		"MIS_PASSWORD_HISTORY":      &c.PasswordPolicy.History,
+	}
+	for key, dst := range ints {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			*dst = n
+		}
+	}
+
+	return nil
+}
@@ -2,31 +2,161 @@ package database
 
 import (
 	"log"
+	"mis-system/config"
 	"mis-system/models"
+	"time"
 
 	"github.com/glebarez/sqlite" // Pure Go SQLite driver
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var DB *gorm.DB
 
 // ConnectDatabase initializes the database connection
-func ConnectDatabase() {
-	database, err := gorm.Open(sqlite.Open("mis.db"), &gorm.Config{})
+func ConnectDatabase(cfg *config.Config) {
+	database, err := gorm.Open(sqlite.Open(cfg.Database.Path), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Accounts created before email verification existed keep signing in as before
+	grandfatherEmails := !database.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
 	// Auto migrate the database
 	err = database.AutoMigrate(
 		&models.User{},
 		&models.Session{},
 		&models.AuthAudit{},
+		&models.PasswordResetToken{},
+		&models.RoleDefinition{},
+		&models.RolePermission{},
+		&models.RevokedToken{},
+		&models.SigningKey{},
+		&models.UserIdentity{},
+		&models.OAuthState{},
+		&models.LoginCode{},
+		&models.LoginAttempt{},
+		&models.RateLimitBucket{},
+		&models.TOTPFactor{},
+		&models.RecoveryCode{},
+		&models.WebAuthnCredential{},
+		&models.PasswordHistory{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// Google links used to live on the users table
+	if err := migrateGoogleSubjects(database); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Accounts without a Google ID must store NULL so the unique index allows more than one
+	if err := database.Exec("UPDATE users SET google_id = NULL WHERE google_id = ''").Error; err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Sessions created before token families existed each start their own family
+	if err := database.Exec("UPDATE sessions SET family_id = 'session-' || id WHERE family_id IS NULL OR family_id = ''").Error; err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Sessions revoked before rotations were recorded were rotated when a later session names them as its parent
+	if err := database.Exec("UPDATE sessions SET rotated_at = revoked_at WHERE rotated_at IS NULL AND revoked_at IS NOT NULL " +
+		"AND id IN (SELECT parent_id FROM sessions WHERE parent_id IS NOT NULL)").Error; err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if grandfatherEmails {
+		if err := database.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	// Passwords set before their age was tracked count from the first start with password expiry
+	if err := database.Exec("UPDATE users SET password_set_at = ? WHERE has_local_password AND password_set_at IS NULL", time.Now()).Error; err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Seed built-in roles and their default permissions
+	if err := seedRoles(database); err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
+	}
+
 	DB = database
 	log.Println("Database connected successfully")
 }
+
+// migrateGoogleSubjects moves Google account links from users.google_sub into user_identities
+// and drops the old column. It does nothing once the column is gone.
+func migrateGoogleSubjects(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.User{}, "google_sub") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var users []struct {
+			ID        uint
+			Email     string
+			GoogleSub string
+		}
+		if err := tx.Table("users").Select("id, email, google_sub").
+			Where("google_sub IS NOT NULL AND google_sub <> ''").Scan(&users).Error; err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			identity := models.UserIdentity{
+				UserID:   u.ID,
+				Provider: models.ProviderGoogle,
+				Subject:  u.GoogleSub,
+				Email:    u.Email,
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&identity).Error; err != nil {
+				return err
+			}
+		}
+
+		// SQLite cannot drop a column while an index or constraint still refers to it
+		if tx.Migrator().HasIndex(&models.User{}, "idx_users_google_sub") {
+			if err := tx.Migrator().DropIndex(&models.User{}, "idx_users_google_sub"); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasConstraint(&models.User{}, "uni_users_google_sub") {
+			if err := tx.Migrator().DropConstraint(&models.User{}, "uni_users_google_sub"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&models.User{}, "google_sub")
+	})
+}
+
+// seedRoles creates the built-in roles on first start.
+// Existing roles keep their edited permissions, except admin which always holds every permission.
+func seedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for name, permissions := range models.DefaultRolePermissions {
+			role := models.RoleDefinition{Name: name, BuiltIn: true}
+			result := tx.Where("name = ?", name).FirstOrCreate(&role)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			// Only seed permissions for newly created roles, or keep admin complete
+			if result.RowsAffected == 0 && name != models.RoleAdmin {
+				continue
+			}
+
+			for _, permission := range permissions {
+				grant := models.RolePermission{RoleDefinitionID: role.ID, Permission: permission}
+				if err := tx.Where(&grant).FirstOrCreate(&grant).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Page describes an offset-based page request
+type Page struct {
+	Number int // 1-based page number
+	Size   int // Items per page
+}
+
+// Offset returns the number of rows skipped before the page
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// TotalPages returns how many pages are needed for total rows
+func (p Page) TotalPages(total int64) int {
+	if p.Size <= 0 {
+		return 0
+	}
+	return int((total + int64(p.Size) - 1) / int64(p.Size))
+}
+
+// SortField describes a single ORDER BY column
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Paginate limits a query to a single page
+func Paginate(p Page) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset(p.Offset()).Limit(p.Size)
+	}
+}
+
+// OrderBy sorts by the given fields. Columns must come from an allowlist, never from raw user input.
+// The primary key is appended as a tie-breaker so pages are stable.
+func OrderBy(fields []SortField) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		hasID := false
+		for _, f := range fields {
+			direction := "ASC"
+			if f.Desc {
+				direction = "DESC"
+			}
+			db = db.Order(fmt.Sprintf("%s %s", f.Column, direction))
+			hasID = hasID || f.Column == "id"
+		}
+		if !hasID {
+			db = db.Order("id ASC")
+		}
+		return db
+	}
+}
+
+// Search matches a case-insensitive substring against any of the given columns
+func Search(term string, columns ...string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		term = strings.TrimSpace(term)
+		if term == "" || len(columns) == 0 {
+			return db
+		}
+
+		pattern := "%" + escapeLike(strings.ToLower(term)) + "%"
+		conditions := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			conditions[i] = fmt.Sprintf("LOWER(%s) LIKE ? ESCAPE '\\'", column)
+			args[i] = pattern
+		}
+
+		return db.Where(strings.Join(conditions, " OR "), args...)
+	}
+}
+
+// TimeRange restricts a timestamp column to [from, to]; nil bounds are ignored
+func TimeRange(column string, from, to *time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if from != nil {
+			db = db.Where(fmt.Sprintf("%s >= ?", column), *from)
+		}
+		if to != nil {
+			db = db.Where(fmt.Sprintf("%s <= ?", column), *to)
+		}
+		return db
+	}
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
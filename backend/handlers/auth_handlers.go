@@ -1,34 +1,53 @@
 package handlers
 
 import (
+	"context"
+	"mis-system/config"
 	"mis-system/database"
+	"mis-system/identity"
+	"mis-system/idtoken"
+	"mis-system/keyring"
+	"mis-system/mailer"
 	"mis-system/models"
+	"mis-system/passwordpolicy"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
-var (
-	jwtKey             = []byte("your_secret_key")                           // In production, this should be an environment variable
-	accessTokenExp     = 15 * time.Minute                                    // 15 minutes
-	refreshTokenExp    = 30 * 24 * time.Hour                                 // 30 days
-	googleClientID     = "your-google-client-id"                             // In production, this should be an environment variable
-	googleClientSecret = "your-google-client-secret"                         // In production, this should be an environment variable
-	googleRedirectURL  = "http://localhost:8080/api/v1/auth/google/callback" // In production, this should be an environment variable
-)
+// cfg holds the runtime configuration; Configure replaces the development defaults at startup
+var cfg = config.Default()
+
+// Outbound mail queue, delivering through the backend selected by the mail configuration
+var mail = newMailQueue(mailer.NewNoopMailer())
+
+// OpenID Connect providers users can sign in with, including Google
+var providers = identity.NewRegistry()
+
+// Verifies Google ID tokens against Google's published keys
+var googleIDTokens = newGoogleIDTokenVerifier(cfg.Google)
 
-// OAuth configuration for Google
-var googleOAuthConfig = oauth2.Config{
-	ClientID:     googleClientID,
-	ClientSecret: googleClientSecret,
-	RedirectURL:  googleRedirectURL,
-	Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
-	Endpoint:     google.Endpoint,
+// Relying party that passkeys are registered with and verified against
+var relyingParty = newRelyingParty(cfg)
+
+// Asymmetric keys that sign and verify access tokens
+var signingKeys *keyring.Keyring
+
+// Configure applies the loaded configuration, signing keys and breached password list to the handlers package.
+// breached is nil when breached passwords are not checked.
+func Configure(c *config.Config, keys *keyring.Keyring, breached *passwordpolicy.BreachedList) {
+	cfg = c
+	signingKeys = keys
+	passwords = newPasswordPolicy(c, breached)
+	googleIDTokens = newGoogleIDTokenVerifier(c.Google)
+	mail.Close(context.Background())
+	mail = newMailQueue(newMailer(c.Mail))
+	providers = newIdentityProviders(c)
+	relyingParty = newRelyingParty(c)
 }
 
 // LoginRequest defines the structure for user login
@@ -52,32 +71,43 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
-// GoogleUserInfo defines the structure of Google user info
-type GoogleUserInfo struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
-	Locale        string `json:"locale"`
-	Sub           string `json:"sub"` // Subject identifier
+// GoogleIDTokenClaims defines the claims of a verified Google ID token
+type GoogleIDTokenClaims struct {
+	idtoken.Claims
+	HostedDomain string `json:"hd"` // Google Workspace domain, empty for consumer accounts
+}
+
+// Profile converts the token claims to the profile of a Google identity
+func (g *GoogleIDTokenClaims) Profile() *identity.Profile {
+	return &identity.Profile{
+		Provider:      models.ProviderGoogle,
+		Subject:       g.Subject,
+		Email:         g.Email,
+		EmailVerified: g.EmailVerified.Value(),
+		Name:          g.Name,
+		GivenName:     g.GivenName,
+		FamilyName:    g.FamilyName,
+		Picture:       g.Picture,
+		Nonce:         g.Nonce,
+	}
 }
 
 // TokenResponse defines the structure of the token response
 type TokenResponse struct {
-	AccessToken  string      `json:"access_token"`
-	RefreshToken string      `json:"refresh_token"`
-	User         interface{} `json:"user"`
+	AccessToken   string      `json:"access_token"`
+	RefreshToken  string      `json:"refresh_token"`
+	User          interface{} `json:"user"`
+	RecoveryCodes []string    `json:"recovery_codes,omitempty"` // Shown once when an authenticator app is set up during sign-in
 }
 
 // Claims defines the structure of the JWT token
 type Claims struct {
-	UserID uint         `json:"user_id"`
-	Email  string       `json:"email"`
-	Roles  models.Roles `json:"roles"`
-	Admin  bool         `json:"admin"`
+	UserID    uint         `json:"user_id"`
+	Email     string       `json:"email"`
+	Roles     models.Roles `json:"roles"`
+	Admin     bool         `json:"admin"`
+	SessionID uint         `json:"sid"`           // Session the token was issued for
+	AMR       []string     `json:"amr,omitempty"` // How the user authenticated, e.g. pwd, fed, hwk, otp and mfa
 	jwt.RegisteredClaims
 }
 
@@ -89,44 +119,66 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	// Find user
+	// Refuse attempts while the account or the client IP is backing off or locked out
+	accountKey := accountThrottleKey(input.Email)
+	wait, err := throttle.Wait(accountKey, ipThrottleKey(c.ClientIP()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		respondLoginThrottled(c, wait)
+		return
+	}
+
+	// Find user; unknown emails count as failures too so they cannot be probed freely
 	var user models.User
 	if result := database.DB.Where("email = ?", input.Email).First(&user); result.Error != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		respondLoginFailed(c, recordLoginFailure(c, nil, input.Email, "Unknown email"))
 		return
 	}
 
-	// Check if user has a local password
+	// Accounts without a local password fail like wrong passwords, so the answer does not tell how an account signs in
 	if !user.HasLocalPassword || user.Password == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "This account uses Google Sign-In. Please log in with Google."})
+		respondLoginFailed(c, recordLoginFailure(c, &user, input.Email, "Account has no password"))
 		return
 	}
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		// Create audit log for failed login
-		createAuthAudit(c, user.ID, models.ActionLogin, false, "Invalid password")
+		respondLoginFailed(c, recordLoginFailure(c, &user, input.Email, "Invalid password"))
+		return
+	}
+
+	// The password was right, so the account's failures no longer count
+	if err := throttle.Reset(accountKey); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset login attempts"})
+		return
+	}
+
+	// Deactivated accounts cannot sign in
+	if !user.IsActive {
+		createAuthAudit(c, user.ID, models.ActionLogin, false, "Account is disabled")
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
 
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	// An expired password was right, but must be replaced before the sign-in completes
+	if passwordExpired(&user) {
+		respondPasswordExpired(c, &user)
 		return
 	}
 
 	// Update last login time
 	user.LastLogin = time.Now()
-	database.DB.Save(&user)
+	database.DB.Model(&user).Update("last_login", user.LastLogin)
 
 	// Create audit log for successful login
 	createAuthAudit(c, user.ID, models.ActionLogin, true, "")
 
-	// Generate tokens
-	tokenResponse, err := generateTokens(c, &user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
-		return
-	}
-
-	// Return tokens and user info
-	c.JSON(http.StatusOK, tokenResponse)
+	// Return tokens, or a challenge when a second factor is needed
+	completeSignIn(c, &user, amrPassword, http.StatusOK)
 }
 
 // AuthMiddleware verifies JWT token for protected routes
@@ -151,22 +203,85 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := authHeader[7:]
 
 		// Parse and validate token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		claims, err := parseClaims(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// Reject tokens revoked on logout or session revocation
+		revoked, err := denylist.IsRevoked(claims.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Deactivation, deletion and revoke-all apply to tokens already issued
+		var user models.User
+		if err := database.DB.Select("id", "is_active", "tokens_valid_after").
+			First(&user, claims.UserID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
+		if !user.IsActive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+		// iat only has second precision, so compare against the start of the invalidation second
+		if claims.IssuedAt == nil || claims.IssuedAt.Time.Before(user.TokensValidAfter.Truncate(time.Second)) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
 
 		// Set user ID in context
 		c.Set("userID", claims.UserID)
 		c.Set("userEmail", claims.Email)
 		c.Set("isAdmin", claims.Admin)
+		c.Set("roles", claims.Roles)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("claims", claims)
 
 		c.Next()
 	}
 }
+
+// parseClaims validates an access token's signature and expiry and returns its claims
+func parseClaims(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, signingKeys.Keyfunc,
+		jwt.WithValidMethods(signingKeys.Methods()),
+		jwt.WithIssuer(cfg.JWT.Issuer))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// parseAccessToken returns the claims of a valid bearer token sent with the request, if any
+func parseAccessToken(c *gin.Context) (*Claims, bool) {
+	tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		return nil, false
+	}
+
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, false
+	}
+
+	return claims, true
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRoles allows the request through only if the authenticated user holds at least one of the given roles.
+// Users with the admin flag are always allowed. It must be used after AuthMiddleware.
+func RequireRoles(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			abortForbidden(c)
+			return
+		}
+
+		if claims.Admin || hasAnyRole(claims.Roles, roles) {
+			c.Next()
+			return
+		}
+
+		abortForbidden(c)
+	}
+}
+
+// RequireAdmin allows the request through only for administrators
+func RequireAdmin() gin.HandlerFunc {
+	return RequireRoles(models.RoleAdmin)
+}
+
+// RequirePermission allows the request through only if one of the user's roles grants the permission.
+// Users with the admin flag hold every permission. It must be used after AuthMiddleware.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := currentClaims(c)
+		if !ok {
+			abortForbidden(c)
+			return
+		}
+
+		allowed, err := hasPermission(claims, permission)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			abortForbidden(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// hasPermission reports whether the token's roles grant the permission
+func hasPermission(claims *Claims, permission models.Permission) (bool, error) {
+	if claims.Admin {
+		return true, nil
+	}
+	if len(claims.Roles) == 0 {
+		return false, nil
+	}
+
+	var count int64
+	err := database.DB.Model(&models.RolePermission{}).
+		Joins("JOIN role_definitions ON role_definitions.id = role_permissions.role_definition_id").
+		Where("role_definitions.name IN ? AND role_permissions.permission = ?", []models.Role(claims.Roles), permission).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// canGrantRoles reports whether the token's roles hold every permission the given roles grant,
+// so assigning them to someone cannot give out more than the granter has. Administrators may grant any role.
+func canGrantRoles(claims *Claims, roles models.Roles) (bool, error) {
+	if claims == nil {
+		return false, nil
+	}
+	if claims.Admin || len(roles) == 0 {
+		return true, nil
+	}
+
+	granted, err := rolesPermissions(roles)
+	if err != nil {
+		return false, err
+	}
+	held, err := rolesPermissions(claims.Roles)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range granted {
+		if !slices.Contains(held, permission) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// rolesPermissions returns the permissions granted by any of the roles
+func rolesPermissions(roles models.Roles) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(roles) == 0 {
+		return permissions, nil
+	}
+
+	err := database.DB.Model(&models.RolePermission{}).
+		Joins("JOIN role_definitions ON role_definitions.id = role_permissions.role_definition_id").
+		Where("role_definitions.name IN ?", []models.Role(roles)).
+		Distinct().Pluck("role_permissions.permission", &permissions).Error
+	return permissions, err
+}
+
+// currentClaims returns the token claims stored by AuthMiddleware
+func currentClaims(c *gin.Context) (*Claims, bool) {
+	value, exists := c.Get("claims")
+	if !exists {
+		return nil, false
+	}
+
+	claims, ok := value.(*Claims)
+	return claims, ok
+}
+
+// isAdmin reports whether the authenticated user is an administrator
+func isAdmin(c *gin.Context) bool {
+	claims, ok := currentClaims(c)
+	if !ok {
+		return false
+	}
+
+	return claims.Admin || hasAnyRole(claims.Roles, []models.Role{models.RoleAdmin})
+}
+
+// hasAnyRole reports whether held contains any of the wanted roles
+func hasAnyRole(held models.Roles, wanted []models.Role) bool {
+	for _, h := range held {
+		for _, w := range wanted {
+			if h == w {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// abortForbidden stops the request with the standard 403 response
+func abortForbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+}
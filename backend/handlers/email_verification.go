@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"mis-system/config"
+	"mis-system/database"
+	"mis-system/identity"
+	"mis-system/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// emailVerificationAudience marks tokens that confirm a user owns their email address
+const emailVerificationAudience = "email-verification"
+
+var errVerificationTokenInvalid = errors.New("invalid email verification token")
+
+// EmailVerificationClaims defines the claims of an email verification token; the subject is the user's ID
+type EmailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// VerifyEmailRequest defines the structure for confirming an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest defines the structure for requesting a new verification link
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyEmail marks the email address a verification token was sent to as verified.
+// Tokens are not single-use, since verifying twice changes nothing, but only work while the user keeps that email.
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := parseEmailVerificationToken(req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, claims.Subject).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	// A link sent before the email changed does not vouch for the new address
+	if !strings.EqualFold(claims.Email, user.Email) {
+		createAuthAudit(c, user.ID, models.ActionEmailVerify, false, "Verification link was sent to a previous email address")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	if !emailVerified(&user) {
+		if err := markEmailVerified(database.DB, &user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		// Create audit log
+		createAuthAudit(c, user.ID, models.ActionEmailVerify, true, "Email "+user.Email+" verified")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail sends a new verification link to an unverified account.
+// It is public so users who cannot sign in yet can use it, and never reveals whether the email is registered.
+func ResendVerificationEmail(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err == nil && user.IsActive && !emailVerified(&user) {
+		sendEmailVerification(c, &user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If your email is registered and not yet verified, you'll receive a new verification link"})
+}
+
+// ResendMyVerificationEmail sends a new verification link to the current user
+func ResendMyVerificationEmail(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if emailVerified(&user) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	sendEmailVerification(c, &user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification link sent to " + user.Email})
+}
+
+// sendEmailVerification emails the user a link confirming their current email address
+func sendEmailVerification(c *gin.Context, user *models.User) {
+	token, err := issueEmailVerificationToken(user)
+	if err != nil {
+		log.Printf("Failed to issue email verification token: %v", err)
+		return
+	}
+
+	sendMail(user.Email, "email_verification", gin.H{
+		"FirstName": user.FirstName,
+		"ActionURL": appURL("/verify-email", url.Values{"token": {token}}),
+		"ExpiresIn": formatDuration(cfg.EmailVerification.TokenTTL),
+	})
+}
+
+// issueEmailVerificationToken signs a token confirming the user's current email address
+func issueEmailVerificationToken(user *models.User) (string, error) {
+	claims := &EmailVerificationClaims{
+		Email: user.Email,
+		RegisteredClaims: internalClaims(emailVerificationAudience, strconv.FormatUint(uint64(user.ID), 10),
+			cfg.EmailVerification.TokenTTL),
+	}
+
+	return signInternalToken(emailVerificationAudience, claims)
+}
+
+// parseEmailVerificationToken validates an email verification token and returns its claims
+func parseEmailVerificationToken(token string) (*EmailVerificationClaims, error) {
+	claims := &EmailVerificationClaims{}
+	err := parseInternalToken(token, emailVerificationAudience, claims)
+	if err != nil || claims.Subject == "" || claims.Email == "" {
+		return nil, errVerificationTokenInvalid
+	}
+
+	return claims, nil
+}
+
+// markEmailVerified records that the user owns their current email address
+func markEmailVerified(tx *gorm.DB, user *models.User) error {
+	user.EmailVerifiedAt = time.Now()
+	return tx.Model(user).Update("email_verified_at", user.EmailVerifiedAt).Error
+}
+
+// verifyEmailFromProvider marks the user's email as verified when an identity provider vouches for the same address
+func verifyEmailFromProvider(tx *gorm.DB, user *models.User, profile *identity.Profile) error {
+	if emailVerified(user) || !profile.EmailVerified || !strings.EqualFold(profile.Email, user.Email) {
+		return nil
+	}
+	return markEmailVerified(tx, user)
+}
+
+// emailVerified reports whether the user has verified their email address
+func emailVerified(user *models.User) bool {
+	return !user.EmailVerifiedAt.IsZero()
+}
+
+// emailVerificationBlocks reports whether the user may not sign in until they verify their email
+func emailVerificationBlocks(user *models.User) bool {
+	return cfg.EmailVerification.Policy == config.EmailPolicyBlock && !emailVerified(user)
+}
+
+// tokenRoles returns the roles and admin flag to put in the user's tokens.
+// Under the restrict policy, unverified users only keep the roles listed in email_verification.unverified_roles.
+func tokenRoles(user *models.User) (models.Roles, bool) {
+	if cfg.EmailVerification.Policy != config.EmailPolicyRestrict || emailVerified(user) {
+		return user.Roles, user.IsAdmin
+	}
+
+	roles := models.Roles{}
+	for _, role := range user.Roles {
+		if slices.Contains(cfg.EmailVerification.UnverifiedRoles, string(role)) {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles, false
+}
+
+// respondEmailUnverified refuses a sign-in or refresh until the user verifies their email
+func respondEmailUnverified(c *gin.Context, user *models.User, action models.AuditAction) {
+	createAuthAudit(c, user.ID, action, false, "Email not verified")
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":                       "Please verify your email address before signing in",
+		"email_verification_required": true,
+	})
+}
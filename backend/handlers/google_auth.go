@@ -4,81 +4,33 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mis-system/config"
 	"mis-system/database"
+	"mis-system/idtoken"
 	"mis-system/models"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // GoogleLogin initiates the Google OAuth flow
 func GoogleLogin(c *gin.Context) {
-	// Generate a random state to prevent CSRF
-	b := make([]byte, 32)
-	if _, err := io.ReadFull(rand.Reader, b); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate state"})
-		return
-	}
-	state := base64.StdEncoding.EncodeToString(b)
-
-	// Store state in cookie for verification later
-	c.SetCookie("oauth_state", state, 3600, "/", "", false, true)
-
-	// Redirect to Google's OAuth page
-	url := googleOAuthConfig.AuthCodeURL(state)
-	c.Redirect(http.StatusTemporaryRedirect, url)
+	oidcLogin(c, models.ProviderGoogle)
 }
 
 // GoogleCallback handles the OAuth callback from Google
 func GoogleCallback(c *gin.Context) {
-	// Verify state to prevent CSRF
-	stateCookie, err := c.Cookie("oauth_state")
-	if err != nil || stateCookie != c.Query("state") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state parameter"})
-		return
-	}
-
-	// Exchange authorization code for token
-	code := c.Query("code")
-	token, err := googleOAuthConfig.Exchange(context.Background(), code)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to exchange code for token"})
-		return
-	}
-
-	// Get user info from Google
-	client := googleOAuthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info from Google"})
-		return
-	}
-	defer resp.Body.Close()
-
-	googleUser := GoogleUserInfo{}
-	if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode Google user info"})
-		return
-	}
-
-	// Process Google user info
-	tokenResponse, err := processGoogleUser(c, &googleUser)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Return tokens and user info
-	c.JSON(http.StatusOK, tokenResponse)
+	oidcCallback(c, models.ProviderGoogle)
 }
 
 // GoogleAuth handles direct Google authentication with ID token
@@ -89,170 +41,91 @@ func GoogleAuth(c *gin.Context) {
 		return
 	}
 
-	// Verify ID token with Google
-	tokenInfo, err := verifyGoogleIDToken(req.IDToken)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google ID token"})
+	// Verify ID token against Google's keys
+	claims, ok := verifyGoogleIDTokenRequest(c, req.IDToken)
+	if !ok {
 		return
 	}
 
-	// Convert tokenInfo to GoogleUserInfo
-	googleUser := GoogleUserInfo{
-		Sub:        tokenInfo["sub"].(string),
-		Email:      tokenInfo["email"].(string),
-		Name:       tokenInfo["name"].(string),
-		GivenName:  tokenInfo["given_name"].(string),
-		FamilyName: tokenInfo["family_name"].(string),
-	}
-
-	if verifiedEmail, ok := tokenInfo["email_verified"].(bool); ok {
-		googleUser.VerifiedEmail = verifiedEmail
-	}
-
-	if picture, ok := tokenInfo["picture"].(string); ok {
-		googleUser.Picture = picture
-	}
-
-	// Process Google user info
-	tokenResponse, err := processGoogleUser(c, &googleUser)
+	// Sign in the user linked to the Google account
+	user, err := signInWithProfile(c, claims.Profile())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondSignInError(c, err)
 		return
 	}
 
-	// Return tokens and user info
-	c.JSON(http.StatusOK, tokenResponse)
+	// Return tokens, or a challenge when a second factor is needed
+	completeSignIn(c, user, amrFederated, http.StatusOK)
 }
 
-// processGoogleUser handles the common processing for Google users
-func processGoogleUser(c *gin.Context, googleUser *GoogleUserInfo) (*TokenResponse, error) {
-	// Look for existing user by Google Sub ID
-	var user models.User
-	result := database.DB.Where("google_sub = ?", googleUser.Sub).First(&user)
-
-	// Check if user exists by email if not found by Google ID
-	if result.Error != nil {
-		result = database.DB.Where("email = ?", googleUser.Email).First(&user)
-	}
-
-	// Create new user if not found
-	if result.Error != nil {
-		// Auto-provision a new user linked to Google
-		names := strings.Fields(googleUser.Name)
-		firstName := googleUser.GivenName
-		lastName := googleUser.FamilyName
-
-		// Fallback to parsed name if given/family name not provided
-		if firstName == "" && len(names) > 0 {
-			firstName = names[0]
-		}
-		if lastName == "" && len(names) > 1 {
-			lastName = strings.Join(names[1:], " ")
-		}
-
-		// Create new user
-		user = models.User{
-			Email:            googleUser.Email,
-			GoogleSub:        googleUser.Sub,
-			FirstName:        firstName,
-			LastName:         lastName,
-			HasLocalPassword: false,
-			IsActive:         true,
-			IsAdmin:          false,
-			Roles:            models.Roles{models.RoleUser}, // Default role
-			LastLogin:        time.Now(),
-		}
-
-		if err := database.DB.Create(&user).Error; err != nil {
-			return nil, err
-		}
-
-		// Create audit log for new user
-		createAuthAudit(c, user.ID, models.ActionRegister, true, "Google account auto-provisioned")
-	} else {
-		// Update existing user with Google info
-		user.GoogleSub = googleUser.Sub
-		user.LastLogin = time.Now()
-
-		// Only update name if previously empty
-		if user.FirstName == "" && googleUser.GivenName != "" {
-			user.FirstName = googleUser.GivenName
-		}
-		if user.LastName == "" && googleUser.FamilyName != "" {
-			user.LastName = googleUser.FamilyName
-		}
-
-		if err := database.DB.Save(&user).Error; err != nil {
-			return nil, err
-		}
+// verifyGoogleIDToken verifies the signature and claims of a Google ID token locally
+func verifyGoogleIDToken(ctx context.Context, idToken string) (*GoogleIDTokenClaims, error) {
+	var claims GoogleIDTokenClaims
+	if err := googleIDTokens.Verify(ctx, idToken, &claims); err != nil {
+		return nil, err
 	}
 
-	// Create auth audit log
-	createAuthAudit(c, user.ID, models.ActionGoogleAuth, true, "")
-
-	// Generate tokens
-	return generateTokens(c, &user)
+	return &claims, nil
 }
 
-// verifyGoogleIDToken verifies the Google ID token
-func verifyGoogleIDToken(idToken string) (map[string]interface{}, error) {
-	// Make a request to Google's token info endpoint
-	resp, err := http.Get("https://oauth2.googleapis.com/tokeninfo?id_token=" + idToken)
-	if err != nil {
-		return nil, err
+// verifyGoogleIDTokenRequest verifies a Google ID token sent by a client, writing a 4xx response
+// that tells malformed, unverified and rejected tokens apart when it fails
+func verifyGoogleIDTokenRequest(c *gin.Context, idToken string) (*GoogleIDTokenClaims, bool) {
+	claims, err := verifyGoogleIDToken(c.Request.Context(), idToken)
+	switch {
+	case errors.Is(err, idtoken.ErrMalformed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed Google ID token"})
+		return nil, false
+	case errors.Is(err, idtoken.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Google account email is not verified"})
+		return nil, false
+	case err != nil:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google ID token"})
+		return nil, false
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to verify token: %s", resp.Status)
+	// Accounts are matched and provisioned by email, so tokens issued without the email scope are unusable
+	if claims.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Google ID token has no email claim"})
+		return nil, false
 	}
 
-	var tokenInfo map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenInfo); err != nil {
-		return nil, err
-	}
+	return claims, true
+}
 
-	// Verify audience (your client ID)
-	if aud, ok := tokenInfo["aud"].(string); !ok || aud != googleClientID {
-		return nil, fmt.Errorf("invalid token audience")
+// newGoogleIDTokenVerifier builds the Google ID token verifier, fetching Google's keys on demand
+func newGoogleIDTokenVerifier(c config.GoogleConfig) *idtoken.Verifier {
+	return &idtoken.Verifier{
+		Keys:                 idtoken.NewRemoteKeySource(c.JWKSURL),
+		Issuers:              []string{"accounts.google.com", "https://accounts.google.com"},
+		Audience:             c.ClientID,
+		ClockSkew:            c.ClockSkew,
+		RequireVerifiedEmail: true,
 	}
-
-	return tokenInfo, nil
 }
 
-// generateTokens creates and returns access and refresh tokens
-func generateTokens(c *gin.Context, user *models.User) (*TokenResponse, error) {
-	// Create access token
-	accessTokenExp := time.Now().Add(accessTokenExp)
-	accessTokenClaims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Roles:  user.Roles,
-		Admin:  user.IsAdmin,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(accessTokenExp),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   user.Email,
-		},
-	}
+// generateTokens creates and returns access and refresh tokens for a new session family
+// signed in with the given authentication methods
+func generateTokens(c *gin.Context, user *models.User, methods ...string) (*TokenResponse, error) {
+	return issueTokens(c, user, nil, methods)
+}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString(jwtKey)
-	if err != nil {
-		return nil, err
-	}
+// rotateTokens creates and returns access and refresh tokens.
+// The new session joins the parent's token family so replays can revoke the whole chain.
+func rotateTokens(c *gin.Context, user *models.User, parent *models.Session) (*TokenResponse, error) {
+	return issueTokens(c, user, parent, sessionAuthMethods(parent))
+}
 
+// issueTokens creates a session and returns its access and refresh tokens
+func issueTokens(c *gin.Context, user *models.User, parent *models.Session, methods []string) (*TokenResponse, error) {
 	// Generate a secure random refresh token
-	refreshTokenBytes := make([]byte, 32)
-	if _, err := io.ReadFull(rand.Reader, refreshTokenBytes); err != nil {
+	refreshTokenString, err := generateSecureToken()
+	if err != nil {
 		return nil, err
 	}
-	refreshTokenString := hex.EncodeToString(refreshTokenBytes)
 
 	// Hash the refresh token for storage
-	hasher := sha256.New()
-	hasher.Write([]byte(refreshTokenString))
-	hashedRefreshToken := hex.EncodeToString(hasher.Sum(nil))
+	hashedRefreshToken := hashToken(refreshTokenString)
 
 	// Get client info
 	deviceID := c.GetHeader("X-Device-ID")
@@ -263,31 +136,64 @@ func generateTokens(c *gin.Context, user *models.User) (*TokenResponse, error) {
 	userAgent := c.GetHeader("User-Agent")
 	ipAddress := c.ClientIP()
 
-	// Create a new session record
+	// Create a new session record, remembering the access token ID so revoking the session also revokes it
+	accessTokenID := newTokenID()
 	session := models.Session{
-		UserID:       user.ID,
-		RefreshToken: hashedRefreshToken,
-		DeviceID:     deviceID,
-		UserAgent:    userAgent,
-		IPAddress:    ipAddress,
-		ExpiresAt:    time.Now().Add(refreshTokenExp),
+		UserID:        user.ID,
+		AccessTokenID: accessTokenID,
+		RefreshToken:  hashedRefreshToken,
+		FamilyID:      uuid.New().String(),
+		DeviceID:      deviceID,
+		UserAgent:     userAgent,
+		IPAddress:     ipAddress,
+		AuthMethods:   strings.Join(methods, ","),
+		ExpiresAt:     time.Now().Add(cfg.JWT.RefreshTokenTTL),
+	}
+	if parent != nil {
+		session.FamilyID = parent.FamilyID
+		session.ParentID = parent.ID
 	}
 
 	if err := database.DB.Create(&session).Error; err != nil {
 		return nil, err
 	}
 
+	// Create access token bound to the session
+	roles, admin := tokenRoles(user)
+	accessTokenExp := time.Now().Add(cfg.JWT.AccessTokenTTL)
+	accessTokenClaims := &Claims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Roles:     roles,
+		Admin:     admin,
+		SessionID: session.ID,
+		AMR:       methods,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(accessTokenExp),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    cfg.JWT.Issuer,
+			Subject:   user.Email,
+			ID:        accessTokenID,
+		},
+	}
+
+	accessTokenString, err := signingKeys.Sign(accessTokenClaims)
+	if err != nil {
+		return nil, err
+	}
+
 	// Return token response
 	return &TokenResponse{
 		AccessToken:  accessTokenString,
 		RefreshToken: refreshTokenString,
 		User: gin.H{
-			"id":        user.ID,
-			"email":     user.Email,
-			"firstName": user.FirstName,
-			"lastName":  user.LastName,
-			"roles":     user.Roles,
-			"isAdmin":   user.IsAdmin,
+			"id":            user.ID,
+			"email":         user.Email,
+			"firstName":     user.FirstName,
+			"lastName":      user.LastName,
+			"roles":         roles,
+			"isAdmin":       admin,
+			"emailVerified": emailVerified(user),
 		},
 	}, nil
 }
@@ -301,14 +207,23 @@ func RefreshToken(c *gin.Context) {
 	}
 
 	// Hash the refresh token to compare with stored hash
-	hasher := sha256.New()
-	hasher.Write([]byte(req.RefreshToken))
-	hashedRefreshToken := hex.EncodeToString(hasher.Sum(nil))
+	hashedRefreshToken := hashToken(req.RefreshToken)
 
-	// Find the session
+	// Find the session, including revoked ones so replays can be detected
 	var session models.Session
-	if err := database.DB.Where("refresh_token = ? AND expires_at > ? AND revoked_at IS NULL",
-		hashedRefreshToken, time.Now()).First(&session).Error; err != nil {
+	if err := database.DB.Where("refresh_token = ?", hashedRefreshToken).First(&session).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	// A rotated token being presented again means it was stolen or leaked; kill the whole family.
+	// Tokens revoked any other way, e.g. by logout or an administrator, are simply refused.
+	if !session.RotatedAt.IsZero() {
+		handleRefreshTokenReuse(c, &session)
+		return
+	}
+
+	if !session.RevokedAt.IsZero() || !session.ExpiresAt.After(time.Now()) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
 		return
 	}
@@ -316,22 +231,65 @@ func RefreshToken(c *gin.Context) {
 	// Get the user
 	var user models.User
 	if err := database.DB.First(&user, session.UserID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if emailVerificationBlocks(&user) {
+		respondEmailUnverified(c, &user, models.ActionRefresh)
+		return
+	}
+
+	// Password sessions end once the password expires. No password change token is handed out here:
+	// the refresh token proves a sign-in, not the password, so the user signs in again to get one.
+	if slices.Contains(sessionAuthMethods(&session), amrPassword) && passwordExpired(&user) {
+		createAuthAudit(c, user.ID, models.ActionRefresh, false, "Password expired")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":            "Your password has expired. Please sign in again to choose a new one",
+			"password_expired": true,
+		})
 		return
 	}
 
-	// Revoke the old refresh token
-	session.RevokedAt = time.Now()
-	if err := database.DB.Save(&session).Error; err != nil {
+	// Sessions started without a second factor end once the user's role requires one
+	if !slices.Contains(sessionAuthMethods(&session), amrMFA) {
+		required, err := mfaRequired(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor authentication"})
+			return
+		}
+		if required {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication is required. Please sign in again."})
+			return
+		}
+	}
+
+	// Revoke the old refresh token; losing this race to a concurrent refresh is also a replay
+	now := time.Now()
+	result := database.DB.Model(&session).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{"revoked_at": now, "rotated_at": now})
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke old token"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		if err := database.DB.First(&session, session.ID).Error; err == nil && !session.RotatedAt.IsZero() {
+			handleRefreshTokenReuse(c, &session)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
 
 	// Create auth audit log
 	createAuthAudit(c, user.ID, models.ActionRefresh, true, "")
 
-	// Generate new tokens
-	tokenResponse, err := generateTokens(c, &user)
+	// Generate new tokens in the same family
+	tokenResponse, err := rotateTokens(c, &user, &session)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate new tokens"})
 		return
@@ -350,11 +308,9 @@ func Logout(c *gin.Context) {
 	}
 
 	// Hash the refresh token
-	hasher := sha256.New()
-	hasher.Write([]byte(req.RefreshToken))
-	hashedRefreshToken := hex.EncodeToString(hasher.Sum(nil))
+	hashedRefreshToken := hashToken(req.RefreshToken)
 
-	// Find and revoke the session
+	// Find the session
 	var session models.Session
 	if err := database.DB.Where("refresh_token = ? AND revoked_at IS NULL",
 		hashedRefreshToken).First(&session).Error; err != nil {
@@ -363,9 +319,21 @@ func Logout(c *gin.Context) {
 		return
 	}
 
-	// Revoke the session
-	session.RevokedAt = time.Now()
-	database.DB.Save(&session)
+	// Revoke the session together with its current access token
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := revokeSessions(tx, "id = ?", session.ID); err != nil {
+			return err
+		}
+
+		// The caller's access token may predate the last refresh, so deny it explicitly
+		if claims, ok := parseAccessToken(c); ok && claims.UserID == session.UserID {
+			return denylist.Revoke(tx, claims.ID, claims.UserID, claims.ExpiresAt.Time)
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
 
 	// Create audit log
 	createAuthAudit(c, session.UserID, models.ActionLogout, true, "")
@@ -373,40 +341,55 @@ func Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-// ForgotPassword initiates password reset
-func ForgotPassword(c *gin.Context) {
-	var req PasswordResetRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// handleRefreshTokenReuse revokes the token family of a replayed refresh token and raises a security event
+func handleRefreshTokenReuse(c *gin.Context, session *models.Session) {
+	revoked, err := revokeSessionFamily(session.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token family"})
 		return
 	}
 
-	// Check if user exists
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		// Don't reveal whether the email exists or not
-		c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you'll receive password reset instructions"})
-		return
-	}
+	createAuthAudit(c, session.UserID, models.ActionTokenReuse, false,
+		fmt.Sprintf("Revoked refresh token for session %d was replayed; revoked %d session(s) in family %s",
+			session.ID, revoked, session.FamilyID))
 
-	// Check if user has a local password
-	if !user.HasLocalPassword {
-		// For security, don't reveal that the user doesn't have a local password
-		c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you'll receive password reset instructions"})
-		return
-	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+}
 
-	// Generate a password reset token (in a real app, this would be stored and used to verify the reset request)
-	// For now we just generate it but don't use it since we're not implementing the full email flow
-	_ = uuid.New().String()
+// revokeSessionFamily revokes every active session that descends from the same login
+func revokeSessionFamily(familyID string) (int64, error) {
+	var revoked int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = revokeSessions(tx, "family_id = ?", familyID)
+		return err
+	})
+	return revoked, err
+}
 
-	// In a real application, send an email with a link including this token
-	// For now, just imagine we've sent an email
+// revokeUserSessions revokes every active session belonging to a user and
+// invalidates all access tokens issued to them so far
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	if _, err := revokeSessions(tx, "user_id = ?", userID); err != nil {
+		return err
+	}
 
-	// Create audit log
-	createAuthAudit(c, user.ID, models.ActionPasswordReset, true, "Password reset requested")
+	return invalidateUserTokens(tx, userID)
+}
+
+// generateSecureToken returns a hex-encoded random token suitable for refresh and reset tokens
+func generateSecureToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you'll receive password reset instructions"})
+// hashToken returns the SHA-256 hex digest of a token for storage and lookup
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // createAuthAudit creates an auth audit log entry
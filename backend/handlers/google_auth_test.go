@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"mis-system/database"
+	"mis-system/idtoken"
+	"mis-system/jwk"
+	"mis-system/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useTestGoogleKeys makes the handlers verify Google ID tokens against a generated key and returns it
+func useTestGoogleKeys(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := jwk.New("google-test", jwt.SigningMethodRS256.Alg(), &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := newGoogleIDTokenVerifier(cfg.Google)
+	verifier.Keys = idtoken.StaticKeySource{Set: jwk.Set{Keys: []jwk.Key{public}}}
+
+	prev := googleIDTokens
+	googleIDTokens = verifier
+	t.Cleanup(func() { googleIDTokens = prev })
+
+	return key
+}
+
+// googleClaims returns the claims of a Google ID token the test verifier accepts
+func googleClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            cfg.Google.ClientID,
+		"sub":            "google-subject",
+		"email":          "google@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// signGoogleToken signs claims as a Google ID token
+func signGoogleToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "google-test"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyGoogleIDTokenRequest(t *testing.T) {
+	setupTestDB(t)
+	cfg.Google.ClientID = "test-client.apps.googleusercontent.com"
+	key := useTestGoogleKeys(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      func() string
+		wantStatus int // Zero when the token is accepted
+	}{
+		{
+			name:  "valid token",
+			token: func() string { return signGoogleToken(t, key, googleClaims()) },
+		},
+		{
+			name: "valid token without profile claims",
+			token: func() string {
+				claims := googleClaims()
+				delete(claims, "name")
+				delete(claims, "picture")
+				return signGoogleToken(t, key, claims)
+			},
+		},
+		{
+			name: "email_verified as a string",
+			token: func() string {
+				claims := googleClaims()
+				claims["email_verified"] = "true"
+				return signGoogleToken(t, key, claims)
+			},
+		},
+		{
+			name:       "malformed token",
+			token:      func() string { return "not-a-jwt" },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unverified email",
+			token: func() string {
+				claims := googleClaims()
+				claims["email_verified"] = false
+				return signGoogleToken(t, key, claims)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "missing email_verified",
+			token: func() string {
+				claims := googleClaims()
+				delete(claims, "email_verified")
+				return signGoogleToken(t, key, claims)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "bad signature",
+			token:      func() string { return signGoogleToken(t, otherKey, googleClaims()) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "another client's token",
+			token: func() string {
+				claims := googleClaims()
+				claims["aud"] = "other-client.apps.googleusercontent.com"
+				return signGoogleToken(t, key, claims)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "no email claim",
+			token: func() string {
+				claims := googleClaims()
+				delete(claims, "email")
+				return signGoogleToken(t, key, claims)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+			claims, ok := verifyGoogleIDTokenRequest(c, tt.token())
+			if tt.wantStatus == 0 {
+				if !ok {
+					t.Fatalf("token refused with %d: %s", w.Code, w.Body)
+				}
+				if profile := claims.Profile(); profile.Subject != "google-subject" || profile.Email != "google@example.com" {
+					t.Errorf("profile = %+v", profile)
+				}
+				return
+			}
+			if ok || w.Code != tt.wantStatus {
+				t.Errorf("accepted = %v, status = %d, want %d: %s", ok, w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenRevokedSessions(t *testing.T) {
+	tests := []struct {
+		name       string
+		revoke     func(t *testing.T, tokens *TokenResponse) // Revokes the refresh token before it is presented
+		wantStatus int
+		wantReuse  bool // Reuse detected: the family is revoked and audited
+	}{
+		{
+			name:       "active token",
+			revoke:     func(t *testing.T, tokens *TokenResponse) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "rotated token presented again",
+			revoke: func(t *testing.T, tokens *TokenResponse) {
+				w := performJSON(RefreshToken, http.MethodPost, RefreshTokenRequest{tokens.RefreshToken}, nil)
+				if w.Code != http.StatusOK {
+					t.Fatalf("first refresh status = %d: %s", w.Code, w.Body)
+				}
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantReuse:  true,
+		},
+		{
+			name: "token revoked by logout",
+			revoke: func(t *testing.T, tokens *TokenResponse) {
+				performJSON(Logout, http.MethodPost, RefreshTokenRequest{tokens.RefreshToken}, nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "token revoked by an administrator",
+			revoke: func(t *testing.T, tokens *TokenResponse) {
+				if _, err := revokeSessions(database.DB, "refresh_token = ?", hashToken(tokens.RefreshToken)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired token",
+			revoke: func(t *testing.T, tokens *TokenResponse) {
+				database.DB.Model(&models.Session{}).Where("refresh_token = ?", hashToken(tokens.RefreshToken)).
+					Update("expires_at", time.Now().Add(-time.Minute))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "refresh@example.com", "old password 1")
+			tokens := signIn(t, user)
+			other := signIn(t, user) // A second login on another device, in its own family
+			tt.revoke(t, tokens)
+
+			w := performJSON(RefreshToken, http.MethodPost, RefreshTokenRequest{tokens.RefreshToken}, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var reuseAudits int64
+			database.DB.Model(&models.AuthAudit{}).Where("action = ?", models.ActionTokenReuse).Count(&reuseAudits)
+			if (reuseAudits > 0) != tt.wantReuse {
+				t.Errorf("refresh_token_reuse audited = %v, want %v", reuseAudits > 0, tt.wantReuse)
+			}
+
+			var active int64
+			database.DB.Model(&models.Session{}).Where("revoked_at IS NULL AND expires_at > ?", time.Now()).Count(&active)
+			wantActive := int64(1) // The other device is never touched
+			if tt.wantStatus == http.StatusOK {
+				wantActive++ // The session the token was rotated into
+			}
+			if active != wantActive {
+				t.Errorf("active sessions = %d, want %d", active, wantActive)
+			}
+
+			// The other device keeps refreshing in every case
+			if w := performJSON(RefreshToken, http.MethodPost, gin.H{"refresh_token": other.RefreshToken}, nil); w.Code != http.StatusOK {
+				t.Errorf("other device refresh status = %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenExpiredPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string        // How the session signed in
+		passwordAt time.Duration // Age of the password
+		wantStatus int
+	}{
+		{name: "password session, current password", method: amrPassword, passwordAt: time.Hour, wantStatus: http.StatusOK},
+		{name: "password session, expired password", method: amrPassword, passwordAt: 48 * time.Hour, wantStatus: http.StatusForbidden},
+		{name: "federated session, expired password", method: amrFederated, passwordAt: 48 * time.Hour, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			cfg.PasswordPolicy.MaxAge = 24 * time.Hour
+			user := createTestUser(t, "expiring@example.com", "old password 1")
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			tokens, err := generateTokens(c, user, tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			database.DB.Model(user).UpdateColumn("password_set_at", time.Now().Add(-tt.passwordAt))
+
+			w := performJSON(RefreshToken, http.MethodPost, RefreshTokenRequest{tokens.RefreshToken}, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				body := decodeJSON(t, w)
+				if body["password_expired"] != true || body["password_change_token"] != nil {
+					t.Errorf("response = %v, want password_expired without a password change token", body)
+				}
+			}
+		})
+	}
+}
@@ -11,7 +11,8 @@ type GoogleVerifyRequest struct {
 	IDToken string `json:"id_token" binding:"required"`
 }
 
-// VerifyGoogleToken verifies a Google ID token and returns user info without creating a session
+// VerifyGoogleToken verifies a Google ID token and returns user info without creating a session.
+// The response carries a short-lived link ticket that RegisterUser accepts to link the Google account.
 func VerifyGoogleToken(c *gin.Context) {
 	var req GoogleVerifyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -19,23 +20,31 @@ func VerifyGoogleToken(c *gin.Context) {
 		return
 	}
 
-	// Verify ID token with Google
-	tokenInfo, err := verifyGoogleIDToken(req.IDToken)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Google ID token"})
+	// Verify ID token against Google's keys
+	claims, ok := verifyGoogleIDTokenRequest(c, req.IDToken)
+	if !ok {
 		return
 	}
 
 	// Return user info without creating a session
 	userInfo := gin.H{
-		"email":      tokenInfo["email"].(string),
-		"sub":        tokenInfo["sub"].(string),
-		"givenName":  tokenInfo["given_name"].(string),
-		"familyName": tokenInfo["family_name"].(string),
-		"name":       tokenInfo["name"].(string),
+		"email":      claims.Email,
+		"sub":        claims.Subject,
+		"givenName":  claims.GivenName,
+		"familyName": claims.FamilyName,
+		"name":       claims.Name,
+	}
+
+	// Issue a ticket proving this Google account was verified
+	ticket, err := issueLinkTicket(claims.Profile())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue link ticket"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user": userInfo,
+		"user":        userInfo,
+		"link_ticket": ticket,
+		"expires_in":  int(cfg.Auth.LinkTicketTTL.Seconds()),
 	})
 }
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mis-system/config"
+	"mis-system/database"
+	"mis-system/keyring"
+	"mis-system/models"
+	"mis-system/secretbox"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+}
+
+// setupTestDB points the handlers at a fresh database, signing keys and default configuration for the duration of a test
+func setupTestDB(t *testing.T) *config.Config {
+	t.Helper()
+
+	c := config.Default()
+	c.Database.Path = filepath.Join(t.TempDir(), "mis.db")
+	database.ConnectDatabase(c)
+	database.DB.Logger = logger.Discard
+
+	box, err := secretbox.New(c.JWT.Secret, "signing-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.New(database.DB, keyring.Options{
+		Algorithm:        "EdDSA",
+		RotationInterval: time.Hour,
+		RetirementGrace:  time.Hour,
+		Box:              box,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevCfg, prevKeys := cfg, signingKeys
+	cfg, signingKeys = c, keys
+	t.Cleanup(func() {
+		cfg, signingKeys = prevCfg, prevKeys
+		if db, err := database.DB.DB(); err == nil {
+			db.Close()
+		}
+	})
+
+	return c
+}
+
+// createTestUser stores an active user, with a local password when password is not empty
+func createTestUser(t *testing.T, email, password string) *models.User {
+	t.Helper()
+
+	user := models.User{Email: email, FirstName: "Test", IsActive: true}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Password = string(hash)
+		user.HasLocalPassword = true
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return &user
+}
+
+// signIn starts a session for the user as a password login would
+func signIn(t *testing.T, user *models.User) *TokenResponse {
+	t.Helper()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", nil)
+	tokens, err := generateTokens(c, user, amrPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// authenticate runs AuthMiddleware on a request bearing the access token and returns the response status
+func authenticate(accessToken string) int {
+	w := performJSON(AuthMiddleware(), http.MethodGet, nil, func(c *gin.Context) {
+		c.Request.Header.Set("Authorization", "Bearer "+accessToken)
+	})
+	return w.Code
+}
+
+// performJSON runs a handler on a JSON request and returns the recorded response.
+// setup, when not nil, runs before the handler, e.g. to put the authenticated user in the context.
+func performJSON(handler gin.HandlerFunc, method string, body interface{}, setup gin.HandlerFunc) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", bytes.NewReader(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if setup != nil {
+		setup(c)
+	}
+	handler(c)
+
+	return w
+}
+
+// decodeJSON decodes a recorded response body
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
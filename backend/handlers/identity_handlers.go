@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyIdentities lists the external accounts linked to the current user
+func GetMyIdentities(c *gin.Context) {
+	var identities []models.UserIdentity
+	if err := database.DB.Where("user_id = ?", c.GetUint("userID")).
+		Order("provider").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": identities})
+}
+
+// LinkGoogleIdentity links the Google account of a verified ID token to the current user
+func LinkGoogleIdentity(c *gin.Context) {
+	var req GoogleAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Verify ID token against Google's keys; only verified emails are accepted
+	claims, ok := verifyGoogleIDTokenRequest(c, req.IDToken)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	link, err := linkIdentity(database.DB, &user, claims.Profile())
+	switch {
+	case errors.Is(err, errIdentityMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "A different Google account is already linked; unlink it first"})
+		return
+	case errors.Is(err, errIdentityTaken):
+		createAuthAudit(c, user.ID, models.ActionIdentityLink, false, "Google account is linked to another user")
+		c.JSON(http.StatusConflict, gin.H{"error": "This Google account is already linked to another user"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link Google account"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionIdentityLink, true, "Google account "+claims.Email+" linked")
+
+	c.JSON(http.StatusOK, gin.H{"data": link})
+}
+
+// UnlinkIdentity removes the current user's linked account at the provider named in the route
+func UnlinkIdentity(c *gin.Context) {
+	provider := c.Param("provider")
+
+	var user models.User
+	if err := database.DB.Preload("Identities").First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var link *models.UserIdentity
+	for i := range user.Identities {
+		if user.Identities[i].Provider == provider {
+			link = &user.Identities[i]
+		}
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No account is linked for this provider"})
+		return
+	}
+
+	// Never leave the account without a way to sign in
+	methods, err := signInMethods(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		return
+	}
+	if methods <= 1 {
+		createAuthAudit(c, user.ID, models.ActionIdentityUnlink, false, providerDisplayName(provider)+" is the only sign-in method")
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password before unlinking this account; it is your only sign-in method"})
+		return
+	}
+
+	if err := database.DB.Delete(link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionIdentityUnlink, true, providerDisplayName(provider)+" account unlinked")
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
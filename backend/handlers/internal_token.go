@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Internal tokens are short-lived HS256 JWTs the server issues to itself, such as MFA challenges, passkey ceremonies,
+// email verification links, link tickets and password change tokens. Each purpose has its own audience and a key
+// derived for that audience, so a token issued for one purpose is never accepted for another.
+
+// internalKey derives an HMAC key for server-issued tokens of one purpose from the JWT secret
+func internalKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(cfg.JWT.Secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// internalClaims returns the registered claims of a new internal token for audience, valid for ttl
+func internalClaims(audience, subject string, ttl time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		Issuer:    cfg.JWT.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		ID:        newTokenID(),
+	}
+}
+
+// signInternalToken signs claims, built with internalClaims for the same audience, with the audience's key
+func signInternalToken(audience string, claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(internalKey(audience))
+}
+
+// parseInternalToken validates a token issued for audience and decodes it into claims.
+// Callers still check the claims their purpose requires.
+func parseInternalToken(token, audience string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return internalKey(audience), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(audience),
+		jwt.WithIssuer(cfg.JWT.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	return err
+}
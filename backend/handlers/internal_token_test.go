@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseInternalToken(t *testing.T) {
+	setupTestDB(t)
+
+	tests := []struct {
+		name     string
+		token    func() (string, error)
+		audience string // Audience the token is parsed for
+		wantErr  bool
+	}{
+		{
+			name: "token of the audience",
+			token: func() (string, error) {
+				claims := internalClaims(mfaChallengeAudience, "1", time.Minute)
+				return signInternalToken(mfaChallengeAudience, &claims)
+			},
+			audience: mfaChallengeAudience,
+		},
+		{
+			name: "token of another audience",
+			token: func() (string, error) {
+				claims := internalClaims(passwordChangeAudience, "1", time.Minute)
+				return signInternalToken(passwordChangeAudience, &claims)
+			},
+			audience: mfaChallengeAudience,
+			wantErr:  true,
+		},
+		{
+			name: "claims naming the audience but signed with another audience's key",
+			token: func() (string, error) {
+				claims := internalClaims(mfaChallengeAudience, "1", time.Minute)
+				return signInternalToken(passwordChangeAudience, &claims)
+			},
+			audience: mfaChallengeAudience,
+			wantErr:  true,
+		},
+		{
+			name: "expired token",
+			token: func() (string, error) {
+				claims := internalClaims(mfaChallengeAudience, "1", -time.Minute)
+				return signInternalToken(mfaChallengeAudience, &claims)
+			},
+			audience: mfaChallengeAudience,
+			wantErr:  true,
+		},
+		{
+			name: "another issuer",
+			token: func() (string, error) {
+				claims := internalClaims(mfaChallengeAudience, "1", time.Minute)
+				claims.Issuer = "someone-else"
+				return signInternalToken(mfaChallengeAudience, &claims)
+			},
+			audience: mfaChallengeAudience,
+			wantErr:  true,
+		},
+		{
+			name: "no expiry",
+			token: func() (string, error) {
+				claims := internalClaims(mfaChallengeAudience, "1", time.Minute)
+				claims.ExpiresAt = nil
+				return signInternalToken(mfaChallengeAudience, &claims)
+			},
+			audience: mfaChallengeAudience,
+			wantErr:  true,
+		},
+		{
+			name: "access token",
+			token: func() (string, error) {
+				claims := internalClaims(mfaChallengeAudience, "1", time.Minute)
+				return signingKeys.Sign(&claims)
+			},
+			audience: mfaChallengeAudience,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.token()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var claims jwt.RegisteredClaims
+			err = parseInternalToken(token, tt.audience, &claims)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseInternalToken() accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseInternalToken() error = %v", err)
+			}
+			if claims.Subject != "1" || claims.ID == "" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
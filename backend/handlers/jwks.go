@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys that verify access tokens
+func GetJWKS(c *gin.Context) {
+	// Keys rotate rarely, but verifiers must pick up a new key well within the retirement grace period
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, signingKeys.JWKS())
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"mis-system/database"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ListMeta describes the page returned by a list endpoint
+type ListMeta struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// parsePage reads the page and per_page query parameters
+func parsePage(c *gin.Context) (database.Page, error) {
+	page := database.Page{Number: 1, Size: defaultPageSize}
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return page, fmt.Errorf("page must be a positive integer")
+		}
+		page.Number = n
+	}
+
+	if v := c.Query("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return page, fmt.Errorf("per_page must be between 1 and %d", maxPageSize)
+		}
+		page.Size = n
+	}
+
+	return page, nil
+}
+
+// parseSort reads a comma-separated sort parameter such as "-created_at,email".
+// allowed maps public sort keys to database columns.
+func parseSort(c *gin.Context, allowed map[string]string) ([]database.SortField, error) {
+	raw := c.Query("sort")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var fields []database.SortField
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+
+		column, ok := allowed[key]
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q", key)
+		}
+		fields = append(fields, database.SortField{Column: column, Desc: desc})
+	}
+
+	return fields, nil
+}
+
+// parseBoolQuery reads an optional boolean query parameter
+func parseBoolQuery(c *gin.Context, name string) (*bool, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+// parseTimeQuery reads an optional RFC 3339 timestamp or YYYY-MM-DD date query parameter
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date", name)
+}
+
+// setPaginationHeaders writes X-Total-Count and RFC 8288 Link headers and returns the response metadata
+func setPaginationHeaders(c *gin.Context, page database.Page, total int64) ListMeta {
+	meta := ListMeta{
+		Page:       page.Number,
+		PerPage:    page.Size,
+		Total:      total,
+		TotalPages: page.TotalPages(total),
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+
+	lastPage := meta.TotalPages
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	links := []string{
+		pageLink(c, 1, page.Size, "first"),
+		pageLink(c, lastPage, page.Size, "last"),
+	}
+	if page.Number > 1 {
+		links = append(links, pageLink(c, min(page.Number-1, lastPage), page.Size, "prev"))
+	}
+	if page.Number < lastPage {
+		links = append(links, pageLink(c, page.Number+1, page.Size, "next"))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+
+	return meta
+}
+
+// pageLink builds a single Link header entry for the current request with a different page
+func pageLink(c *gin.Context, number, size int, rel string) string {
+	u := url.URL{Path: c.Request.URL.Path}
+	query := c.Request.URL.Query()
+	query.Set("page", strconv.Itoa(number))
+	query.Set("per_page", strconv.Itoa(size))
+	u.RawQuery = query.Encode()
+
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loginThrottle slows down and locks out password guessing per account and per client IP.
+// Counters live in the login_attempts table so lockouts survive restarts.
+type loginThrottle struct {
+	mu sync.Mutex // Serializes read-modify-write of counters within this process
+}
+
+// throttle is the process-wide login throttle
+var throttle = &loginThrottle{}
+
+// accountThrottleKey returns the counter subject for an email, whether or not an account exists
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipThrottleKey returns the counter subject for a client IP
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Wait returns how long the caller must wait before another attempt is checked for any of the subjects
+func (t *loginThrottle) Wait(subjects ...string) (time.Duration, error) {
+	var attempts []models.LoginAttempt
+	if err := database.DB.Where("subject IN ?", subjects).Find(&attempts).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, attempt := range attempts {
+		wait = max(wait, attemptWait(&attempt))
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt for subject and returns the updated counter.
+// Failures beyond free back off exponentially; locked reports whether this failure reached the
+// lockout threshold, where a threshold of 0 never locks.
+func (t *loginThrottle) Fail(subject string, free, lockout int) (attempt *models.LoginAttempt, locked bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	attempt = &models.LoginAttempt{Subject: subject}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subject = ?", subject).FirstOrInit(attempt).Error; err != nil {
+			return err
+		}
+
+		// Start over once a lockout has ended or the last failure is old enough
+		lockEnded := !attempt.LockedUntil.IsZero() && !attempt.LockedUntil.After(now)
+		if lockEnded || now.Sub(attempt.LastFailureAt) > cfg.Login.FailureWindow {
+			attempt.Failures = 0
+			attempt.LockedUntil = time.Time{}
+		}
+
+		attempt.Failures++
+		attempt.LastFailureAt = now
+		if over := attempt.Failures - free; over > 0 {
+			attempt.RetryAfter = now.Add(loginBackoff(over))
+		}
+		if lockout > 0 && attempt.Failures >= lockout && attempt.LockedUntil.IsZero() {
+			attempt.LockedUntil = now.Add(cfg.Login.LockoutDuration)
+			locked = true
+		}
+
+		return tx.Save(attempt).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return attempt, locked, nil
+}
+
+// Reset forgets the failures recorded for subject
+func (t *loginThrottle) Reset(subject string) error {
+	return database.DB.Where("subject = ?", subject).Delete(&models.LoginAttempt{}).Error
+}
+
+// loginBackoff returns the wait after the given number of throttled failures, doubling each time
+func loginBackoff(over int) time.Duration {
+	wait := float64(cfg.Login.BackoffBase) * math.Pow(2, float64(over-1))
+	if wait >= float64(cfg.Login.BackoffMax) {
+		return cfg.Login.BackoffMax
+	}
+	return time.Duration(wait)
+}
+
+// attemptWait returns how long a counter still blocks attempts
+func attemptWait(attempt *models.LoginAttempt) time.Duration {
+	return max(time.Until(attempt.RetryAfter), time.Until(attempt.LockedUntil), 0)
+}
+
+// recordLoginFailure audits a failed login and counts it against the account and the client IP.
+// It returns how long the client must wait before trying again.
+func recordLoginFailure(c *gin.Context, user *models.User, email, reason string) time.Duration {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+	createAuthAudit(c, userID, models.ActionLogin, false, reason)
+
+	var wait time.Duration
+	account, locked, err := throttle.Fail(accountThrottleKey(email), cfg.Login.FreeAttempts, cfg.Login.AccountLockout)
+	if err == nil {
+		wait = max(wait, attemptWait(account))
+		if locked {
+			createAuthAudit(c, userID, models.ActionAccountLock, true,
+				fmt.Sprintf("Locked after %d failed logins", account.Failures))
+		}
+	}
+
+	// Many users can share an IP, so it is only locked out, never backed off
+	if cfg.Login.IPLockout > 0 {
+		ip, locked, err := throttle.Fail(ipThrottleKey(c.ClientIP()), math.MaxInt, cfg.Login.IPLockout)
+		if err == nil {
+			wait = max(wait, attemptWait(ip))
+			if locked {
+				createAuthAudit(c, 0, models.ActionAccountLock, true,
+					fmt.Sprintf("Client IP locked out after %d failed logins", ip.Failures))
+			}
+		}
+	}
+
+	return wait
+}
+
+// setRetryAfter tells the client how many whole seconds to wait
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+// respondLoginFailed rejects wrong credentials, announcing any backoff the failure triggered
+func respondLoginFailed(c *gin.Context, wait time.Duration) {
+	if wait > 0 {
+		setRetryAfter(c, wait)
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+}
+
+// respondLoginThrottled rejects a login attempt made before the client's wait is over
+func respondLoginThrottled(c *gin.Context, wait time.Duration) {
+	setRetryAfter(c, wait)
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Please try again later."})
+}
+
+// GetUserLockout returns the failed login counter of a user's account
+func GetUserLockout(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	var attempt models.LoginAttempt
+	if err := database.DB.Where("subject = ?", accountThrottleKey(user.Email)).
+		FirstOrInit(&attempt, models.LoginAttempt{Subject: accountThrottleKey(user.Email)}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load lockout state"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"failures":        attempt.Failures,
+		"last_failure_at": attempt.LastFailureAt,
+		"retry_after":     attempt.RetryAfter,
+		"locked_until":    attempt.LockedUntil,
+		"locked":          attempt.LockedUntil.After(time.Now()),
+	}})
+}
+
+// UnlockUser lifts a lockout and clears the failed login and second factor counters of a user's account
+func UnlockUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Where("subject IN ?", []string{accountThrottleKey(user.Email), mfaThrottleKey(user.ID)}).
+		Delete(&models.LoginAttempt{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionAccountUnlock, true, fmt.Sprintf("Unlocked by user %d", c.GetUint("userID")))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecordLoginFailureIPLockout(t *testing.T) {
+	tests := []struct {
+		name       string
+		ipLockout  int
+		failures   int
+		wantLocked bool // The client IP is locked out after the failures
+	}{
+		{"IP lockout disabled", 0, 20, false},
+		{"below the IP lockout", 5, 4, false},
+		{"at the IP lockout", 5, 5, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			cfg.Login.IPLockout = tt.ipLockout
+
+			// Every failure is for another account, as from users sharing a NAT
+			var wait time.Duration
+			for i := range tt.failures {
+				c, _ := gin.CreateTestContext(httptest.NewRecorder())
+				c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+				c.Request.RemoteAddr = "203.0.113.7:4242"
+				wait = max(wait, recordLoginFailure(c, nil, fmt.Sprintf("user%d@example.com", i), "test"))
+			}
+
+			ipWait, err := throttle.Wait(ipThrottleKey("203.0.113.7"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if locked := ipWait > 0; locked != tt.wantLocked {
+				t.Errorf("IP locked = %v (wait %v), want %v", locked, ipWait, tt.wantLocked)
+			}
+			if !tt.wantLocked && wait > 0 {
+				t.Errorf("failure reported a wait of %v before the IP lockout", wait)
+			}
+
+			var counters int64
+			database.DB.Model(&models.LoginAttempt{}).Where("subject = ?", ipThrottleKey("203.0.113.7")).Count(&counters)
+			if tt.ipLockout == 0 && counters != 0 {
+				t.Error("failures counted against the IP with IP lockout disabled")
+			}
+		})
+	}
+}
+
+func TestLoginFailuresLookAlike(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "local@example.com", "old password 1")
+	createTestUser(t, "federated@example.com", "")
+
+	tests := []struct {
+		name  string
+		input LoginRequest
+	}{
+		{"unknown email", LoginRequest{Email: "nobody@example.com", Password: "some password"}},
+		{"wrong password", LoginRequest{Email: "local@example.com", Password: "wrong password"}},
+		{"account without a password", LoginRequest{Email: "federated@example.com", Password: "some password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performJSON(LoginUser, http.MethodPost, tt.input, nil)
+			if w.Code != http.StatusUnauthorized || decodeJSON(t, w)["error"] != "Invalid email or password" {
+				t.Errorf("response = %d %s, want the generic login failure", w.Code, w.Body)
+			}
+
+			var attempt models.LoginAttempt
+			if err := database.DB.Where("subject = ?", accountThrottleKey(tt.input.Email)).First(&attempt).Error; err != nil || attempt.Failures != 1 {
+				t.Errorf("account failures = %d (%v), want 1", attempt.Failures, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mis-system/config"
+	"mis-system/mailer"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// mailTimeout bounds how long a single delivery may wait on the mail backend
+const mailTimeout = 10 * time.Second
+
+// mailQueueOptions sizes the outbound mail queue and how hard it tries to deliver each message
+var mailQueueOptions = mailer.QueueOptions{
+	Size:       100,
+	Attempts:   3,
+	Timeout:    mailTimeout,
+	RetryDelay: 5 * time.Second,
+}
+
+// sendMail renders a mail template and queues it for delivery to a single recipient.
+// Delivery runs in the background and failures are only logged, so neither the response nor its timing
+// reveals whether an email was sent.
+func sendMail(to, template string, data interface{}) {
+	msg, err := mailer.Render(template, data)
+	if err != nil {
+		log.Printf("Failed to render %s email: %v", template, err)
+		return
+	}
+	msg.From = cfg.Mail.From
+	msg.To = []string{to}
+
+	if err := mail.Send(context.Background(), msg); err != nil {
+		log.Printf("Failed to queue %s email: %v", template, err)
+	}
+}
+
+// CloseMail stops queueing mail and waits for queued messages to be delivered, giving up when ctx ends
+func CloseMail(ctx context.Context) error {
+	return mail.Close(ctx)
+}
+
+// newMailQueue starts a queue delivering through backend
+func newMailQueue(backend mailer.Mailer) *mailer.Queue {
+	return mailer.NewQueue(backend, mailQueueOptions)
+}
+
+// newMailer creates the mail backend selected by the configuration
+func newMailer(c config.MailConfig) mailer.Mailer {
+	switch c.Backend {
+	case "smtp":
+		return mailer.NewSMTPMailer(c.Host, c.Port, c.Username, c.Password)
+	case "file":
+		return mailer.NewFileMailer(c.Dir)
+	default:
+		return mailer.NewNoopMailer()
+	}
+}
+
+// appURL builds an absolute link into the frontend application
+func appURL(path string, query url.Values) string {
+	u := strings.TrimRight(cfg.AppURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// formatDuration renders a duration in words for use in emails
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return pluralize(int(d/time.Hour), "hour")
+	case d >= time.Minute:
+		return pluralize(int(d/time.Minute), "minute")
+	default:
+		return pluralize(int(d/time.Second), "second")
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"mis-system/mailer"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowMailer stands in for an SMTP server that takes a while to accept each message
+type slowMailer struct {
+	delay time.Duration
+	sent  chan *mailer.Message
+}
+
+func (m *slowMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	select {
+	case <-time.After(m.delay):
+		m.sent <- msg
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestForgotPasswordDoesNotWaitForMail(t *testing.T) {
+	setupTestDB(t)
+	createTestUser(t, "known@example.com", "old password 1")
+
+	slow := &slowMailer{delay: 500 * time.Millisecond, sent: make(chan *mailer.Message, 1)}
+	prev := mail
+	mail = newMailQueue(slow)
+	t.Cleanup(func() {
+		mail.Close(context.Background())
+		mail = prev
+	})
+
+	tests := []struct {
+		name     string
+		email    string
+		wantMail bool
+	}{
+		{"unknown email", "unknown@example.com", false},
+		{"known email", "known@example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			w := performJSON(ForgotPassword, http.MethodPost, gin.H{"email": tt.email}, nil)
+			elapsed := time.Since(start)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if elapsed >= slow.delay {
+				t.Errorf("response took %v, waiting on mail delivery", elapsed)
+			}
+
+			select {
+			case msg := <-slow.sent:
+				if !tt.wantMail {
+					t.Errorf("unexpected mail to %v", msg.To)
+				} else if msg.To[0] != tt.email {
+					t.Errorf("mail sent to %v, want %s", msg.To, tt.email)
+				}
+			case <-time.After(2 * slow.delay):
+				if tt.wantMail {
+					t.Error("reset mail never delivered")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"mis-system/secretbox"
+	"mis-system/totp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Authentication method references (RFC 8176) recorded in the amr claim and on sessions
+const (
+	amrPassword  = "pwd"
+	amrFederated = "fed" // Signed in through an external identity provider
+	amrOTP       = "otp"
+	amrMFA       = "mfa"
+)
+
+// mfaChallengeAudience marks tokens proving the first factor of a sign-in that still needs a second one
+const mfaChallengeAudience = "mfa-challenge"
+
+var (
+	errMFAChallengeInvalid = errors.New("invalid or expired mfa challenge")
+	errMFACodeInvalid      = errors.New("invalid verification code")
+	errMFANotEnrolled      = errors.New("no authenticator app is set up")
+	errMFAEnrolled         = errors.New("an authenticator app is already set up")
+)
+
+// MFAChallengeClaims defines the claims of an MFA challenge token; the subject is the user ID
+type MFAChallengeClaims struct {
+	Methods []string `json:"amr"`              // How the first factor was checked
+	Enroll  bool     `json:"enroll,omitempty"` // The user must set up an authenticator app before verifying
+	jwt.RegisteredClaims
+}
+
+// MFAChallengeResponse is returned in place of tokens when a sign-in needs a second factor
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	MFAToken       string `json:"mfa_token"`
+	EnrollRequired bool   `json:"enroll_required"` // Call /auth/mfa/enroll first; the first code confirms the app
+	ExpiresIn      int    `json:"expires_in"`      // Seconds
+}
+
+// MFAChallengeRequest defines the structure for acting on a pending sign-in
+type MFAChallengeRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFACodeRequest carries a code from the authenticator app or, in its place, a recovery code
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// MFAVerifyRequest defines the structure for completing a sign-in with a second factor
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	MFACodeRequest
+}
+
+// TOTPEnrollmentResponse carries a new authenticator app secret; URI is the QR code payload
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// completeSignIn finishes a sign-in whose first factor was checked with method.
+// Users with an authenticator app, or whose roles require one, get a challenge for /auth/mfa/verify instead of tokens.
+func completeSignIn(c *gin.Context, user *models.User, method string, status int) {
+	if emailVerificationBlocks(user) {
+		respondEmailUnverified(c, user, models.ActionLogin)
+		return
+	}
+
+	enrolled, err := hasConfirmedTOTP(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor authentication"})
+		return
+	}
+
+	required := false
+	if !enrolled {
+		if required, err = mfaRequired(user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor authentication"})
+			return
+		}
+	}
+
+	if !enrolled && !required {
+		tokenResponse, err := generateTokens(c, user, method)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+
+		c.JSON(status, tokenResponse)
+		return
+	}
+
+	challenge, err := issueMFAChallenge(user, []string{method}, !enrolled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired:    true,
+		MFAToken:       challenge,
+		EnrollRequired: !enrolled,
+		ExpiresIn:      int(cfg.MFA.ChallengeTTL.Seconds()),
+	})
+}
+
+// issueMFAChallenge signs a short-lived token proving the user passed the first factor
+func issueMFAChallenge(user *models.User, methods []string, enroll bool) (string, error) {
+	claims := &MFAChallengeClaims{
+		Methods:          methods,
+		Enroll:           enroll,
+		RegisteredClaims: internalClaims(mfaChallengeAudience, strconv.FormatUint(uint64(user.ID), 10), cfg.MFA.ChallengeTTL),
+	}
+
+	return signInternalToken(mfaChallengeAudience, claims)
+}
+
+// parseMFAChallenge validates an MFA challenge token and returns its claims
+func parseMFAChallenge(token string) (*MFAChallengeClaims, error) {
+	claims := &MFAChallengeClaims{}
+	err := parseInternalToken(token, mfaChallengeAudience, claims)
+	if err != nil || claims.Subject == "" || claims.ID == "" || len(claims.Methods) == 0 {
+		return nil, errMFAChallengeInvalid
+	}
+
+	return claims, nil
+}
+
+// loadMFAChallenge validates a challenge token and loads its user, responding on failure
+func loadMFAChallenge(c *gin.Context, token string) (*MFAChallengeClaims, *models.User, bool) {
+	claims, err := parseMFAChallenge(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil, nil, false
+	}
+
+	// A used challenge stays denied until it expires
+	used, err := denylist.IsRevoked(claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify MFA token"})
+		return nil, nil, false
+	}
+
+	var user models.User
+	if used || database.DB.First(&user, claims.Subject).Error != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil, nil, false
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return nil, nil, false
+	}
+
+	return claims, &user, true
+}
+
+// VerifyMFA completes a sign-in with a code from the authenticator app or a recovery code.
+// For users setting up their app during sign-in, the first code confirms it and recovery codes are returned.
+func VerifyMFA(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, user, ok := loadMFAChallenge(c, req.MFAToken)
+	if !ok || !checkMFAThrottle(c, user.ID) {
+		return
+	}
+
+	var recoveryCodes []string
+	var factor string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if claims.Enroll {
+			if err := confirmTOTP(tx, user.ID, req.Code); err != nil {
+				return err
+			}
+			codes, err := replaceRecoveryCodes(tx, user.ID)
+			if err != nil {
+				return err
+			}
+			recoveryCodes, factor = codes, "Authenticator app confirmed"
+		} else {
+			var err error
+			if factor, err = verifySecondFactor(tx, user.ID, req.MFACodeRequest); err != nil {
+				return err
+			}
+		}
+
+		// Each challenge completes one sign-in
+		consumed, err := denylist.Consume(tx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return err
+		}
+		if !consumed {
+			return errMFAChallengeInvalid
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errMFACodeInvalid):
+		respondMFAFailed(c, user.ID)
+		return
+	case errors.Is(err, errMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set up an authenticator app first"})
+		return
+	case errors.Is(err, errMFAChallengeInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	if err := throttle.Reset(mfaThrottleKey(user.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset verification attempts"})
+		return
+	}
+
+	// Create audit log
+	if claims.Enroll {
+		createAuthAudit(c, user.ID, models.ActionMFAEnroll, true, factor)
+	}
+	createAuthAudit(c, user.ID, models.ActionMFAVerify, true, factor)
+
+	// Generate tokens recording both factors
+	tokenResponse, err := generateTokens(c, user, append(claims.Methods, amrOTP, amrMFA)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	tokenResponse.RecoveryCodes = recoveryCodes
+
+	c.JSON(http.StatusOK, tokenResponse)
+}
+
+// EnrollMFA starts authenticator app setup for a user whose role requires a second factor they do not have yet
+func EnrollMFA(c *gin.Context) {
+	var req MFAChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, user, ok := loadMFAChallenge(c, req.MFAToken)
+	if !ok {
+		return
+	}
+	if !claims.Enroll {
+		c.JSON(http.StatusConflict, gin.H{"error": "An authenticator app is already set up"})
+		return
+	}
+
+	respondTOTPEnrollment(c, user)
+}
+
+// respondTOTPEnrollment stores a new unconfirmed authenticator app secret and returns it
+func respondTOTPEnrollment(c *gin.Context, user *models.User) {
+	enrollment, err := beginTOTPEnrollment(user)
+	if errors.Is(err, errMFAEnrolled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An authenticator app is already set up"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up authenticator app"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"data": enrollment})
+}
+
+// beginTOTPEnrollment stores a new secret for the user, replacing any earlier one that was never confirmed
+func beginTOTPEnrollment(user *models.User) (*TOTPEnrollmentResponse, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	box, err := totpSecretBox()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := box.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		enrolled, err := hasConfirmedTOTP(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		if enrolled {
+			return errMFAEnrolled
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TOTPFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TOTPFactor{UserID: user.ID, Secret: sealed}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollmentResponse{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(cfg.MFA.Issuer, user.Email, secret),
+	}, nil
+}
+
+// confirmTOTP enables the user's pending authenticator app once it produces a valid code
+func confirmTOTP(tx *gorm.DB, userID uint, code string) error {
+	var factor models.TOTPFactor
+	if err := tx.Where("user_id = ? AND confirmed_at IS NULL", userID).First(&factor).Error; err != nil {
+		return errMFANotEnrolled
+	}
+
+	step, err := validateTOTP(&factor, code)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&factor).Updates(map[string]interface{}{
+		"confirmed_at":   time.Now(),
+		"last_used_step": step,
+	}).Error
+}
+
+// verifySecondFactor accepts a code from the user's confirmed authenticator app or an unused recovery code.
+// It returns a description of the factor used for audit logs.
+func verifySecondFactor(tx *gorm.DB, userID uint, req MFACodeRequest) (string, error) {
+	if req.RecoveryCode != "" {
+		return "Recovery code used", useRecoveryCode(tx, userID, req.RecoveryCode)
+	}
+
+	var factor models.TOTPFactor
+	if err := tx.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&factor).Error; err != nil {
+		return "", errMFANotEnrolled
+	}
+
+	step, err := validateTOTP(&factor, req.Code)
+	if err != nil {
+		return "", err
+	}
+
+	// Codes are valid for a whole step, so each one is only accepted once
+	result := tx.Model(&factor).Where("last_used_step < ?", step).Update("last_used_step", step)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errMFACodeInvalid
+	}
+
+	return "Authenticator app code used", nil
+}
+
+// validateTOTP checks a code against a factor's secret and returns its time step
+func validateTOTP(factor *models.TOTPFactor, code string) (int64, error) {
+	box, err := totpSecretBox()
+	if err != nil {
+		return 0, err
+	}
+	secret, err := box.Open(factor.Secret)
+	if err != nil {
+		return 0, err
+	}
+
+	step, ok := totp.Validate(secret, strings.ReplaceAll(code, " ", ""), time.Now(), cfg.MFA.Skew)
+	if !ok || step <= factor.LastUsedStep {
+		return 0, errMFACodeInvalid
+	}
+
+	return step, nil
+}
+
+// useRecoveryCode marks one of the user's unused recovery codes as used
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errMFACodeInvalid
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and generates a new set, returned in plain text once
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, cfg.MFA.RecoveryCodes)
+	rows := make([]models.RecoveryCode, len(codes))
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(code))}
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns a random code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes the way users tend to retype codes
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// totpSecretBox returns the box that seals authenticator app secrets
+func totpSecretBox() (*secretbox.Box, error) {
+	return secretbox.New(cfg.JWT.Secret, "totp-secrets")
+}
+
+// hasConfirmedTOTP reports whether the user has a confirmed authenticator app
+func hasConfirmedTOTP(tx *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.TOTPFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// mfaRequired reports whether any of the user's roles requires a second factor; the admin flag counts as the admin role
+func mfaRequired(user *models.User) (bool, error) {
+	roles := slices.Clone([]models.Role(user.Roles))
+	if user.IsAdmin {
+		roles = append(roles, models.RoleAdmin)
+	}
+	if len(roles) == 0 {
+		return false, nil
+	}
+
+	var count int64
+	err := database.DB.Model(&models.RoleDefinition{}).
+		Where("name IN ? AND require_mfa = ?", roles, true).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// sessionAuthMethods returns the amr values recorded for a session
+func sessionAuthMethods(session *models.Session) []string {
+	if session.AuthMethods == "" {
+		return nil
+	}
+	return strings.Split(session.AuthMethods, ",")
+}
+
+// mfaThrottleKey returns the counter subject for second factor attempts of a user
+func mfaThrottleKey(userID uint) string {
+	return fmt.Sprintf("mfa:%d", userID)
+}
+
+// checkMFAThrottle refuses code attempts while the user is backing off or locked out after wrong codes
+func checkMFAThrottle(c *gin.Context, userID uint) bool {
+	wait, err := throttle.Wait(mfaThrottleKey(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification attempts"})
+		return false
+	}
+	if wait > 0 {
+		setRetryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed verification attempts. Please try again later."})
+		return false
+	}
+
+	return true
+}
+
+// respondMFAFailed audits and counts a wrong code, then rejects it with any backoff the failure triggered.
+// Codes are counted like passwords, so six digits cannot be guessed within a challenge's lifetime.
+func respondMFAFailed(c *gin.Context, userID uint) {
+	createAuthAudit(c, userID, models.ActionMFAVerify, false, "Invalid verification code")
+
+	attempt, locked, err := throttle.Fail(mfaThrottleKey(userID), cfg.Login.FreeAttempts, cfg.Login.AccountLockout)
+	if err == nil {
+		if wait := attemptWait(attempt); wait > 0 {
+			setRetryAfter(c, wait)
+		}
+		if locked {
+			createAuthAudit(c, userID, models.ActionAccountLock, true,
+				fmt.Sprintf("Two-factor verification locked after %d wrong codes", attempt.Failures))
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateRoleMFARequest defines the structure for the second factor policy of a role
+type UpdateRoleMFARequest struct {
+	RequireMFA *bool `json:"require_mfa" binding:"required"`
+}
+
+// GetMyMFA returns the current user's two-factor authentication status
+func GetMyMFA(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var factor models.TOTPFactor
+	if err := database.DB.Where("user_id = ? AND confirmed_at IS NOT NULL", user.ID).
+		Limit(1).Find(&factor).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor authentication"})
+		return
+	}
+
+	var remaining int64
+	if err := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&remaining).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor authentication"})
+		return
+	}
+
+	required, err := mfaRequired(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"enabled":                  factor.ID != 0,
+		"confirmed_at":             factor.ConfirmedAt,
+		"required":                 required,
+		"recovery_codes_remaining": remaining,
+	}})
+}
+
+// BeginMyTOTP generates a new authenticator app secret for the current user; it is enabled by ConfirmMyTOTP
+func BeginMyTOTP(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	respondTOTPEnrollment(c, &user)
+}
+
+// ConfirmMyTOTP enables the current user's pending authenticator app and returns fresh recovery codes
+func ConfirmMyTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	if !checkMFAThrottle(c, userID) {
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := confirmTOTP(tx, userID, req.Code); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if !respondMFAError(c, userID, err, "Failed to confirm authenticator app") {
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, userID, models.ActionMFAEnroll, true, "Authenticator app confirmed")
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"recovery_codes": codes}})
+}
+
+// DisableMyTOTP removes the current user's authenticator app and recovery codes after checking one of them
+func DisableMyTOTP(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	required, err := mfaRequired(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor authentication"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your role requires two-factor authentication"})
+		return
+	}
+
+	if !checkMFAThrottle(c, user.ID) {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := verifySecondFactor(tx, user.ID, req); err != nil {
+			return err
+		}
+		return deleteMFA(tx, user.ID)
+	})
+	if !respondMFAError(c, user.ID, err, "Failed to disable two-factor authentication") {
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionMFADisable, true, "Authenticator app removed")
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// RegenerateMyRecoveryCodes replaces the current user's recovery codes after checking a second factor
+func RegenerateMyRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	if !checkMFAThrottle(c, userID) {
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := verifySecondFactor(tx, userID, req); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if !respondMFAError(c, userID, err, "Failed to generate recovery codes") {
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, userID, models.ActionMFAEnroll, true, "Recovery codes regenerated")
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"recovery_codes": codes}})
+}
+
+// ResetUserMFA removes a user's authenticator app and recovery codes, e.g. after a lost phone.
+// Users whose role requires a second factor set up a new app at their next sign-in.
+func ResetUserMFA(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteMFA(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Where("subject = ?", mfaThrottleKey(user.ID)).Delete(&models.LoginAttempt{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionMFADisable, true, fmt.Sprintf("Reset by user %d", c.GetUint("userID")))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// UpdateRoleMFA sets whether members of a role must sign in with a second factor.
+// Sessions started without one can no longer be refreshed once their role requires it.
+func UpdateRoleMFA(c *gin.Context) {
+	var role models.RoleDefinition
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	var input UpdateRoleMFARequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Model(&role).Update("require_mfa", *input.RequireMFA).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	createAuthAudit(c, c.GetUint("userID"), models.ActionRoleUpdate, true,
+		fmt.Sprintf("Role %s two-factor requirement set to %t", role.Name, *input.RequireMFA))
+
+	database.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, gin.H{"data": role})
+}
+
+// deleteMFA removes a user's authenticator app and recovery codes
+func deleteMFA(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TOTPFactor{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// respondMFAError answers a failed second factor check, reporting whether err was nil
+func respondMFAError(c *gin.Context, userID uint, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errMFACodeInvalid):
+		respondMFAFailed(c, userID)
+	case errors.Is(err, errMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No authenticator app is set up"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
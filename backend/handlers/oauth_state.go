@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// oauthStateCookie binds a pending sign-in to the browser that started it
+const oauthStateCookie = "oauth_state"
+
+var (
+	errRedirectURINotAllowed = errors.New("redirect uri is not allowed")
+	errOAuthStateInvalid     = errors.New("invalid or expired oauth state")
+	errLoginCodeInvalid      = errors.New("invalid or expired login code")
+)
+
+// LoginCodeRequest defines the structure for exchanging a login code
+type LoginCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// redirectURIs returns the SPA pages OAuth sign-in may hand off to; the first is the default
+func redirectURIs() []string {
+	if len(cfg.Auth.RedirectURIs) > 0 {
+		return cfg.Auth.RedirectURIs
+	}
+	return []string{strings.TrimSuffix(cfg.AppURL, "/") + "/auth/callback"}
+}
+
+// beginOAuthState stores a pending sign-in and returns its state parameter.
+// Only exact matches of the configured redirect URIs are accepted.
+func beginOAuthState(provider, redirectURI string) (string, *models.OAuthState, error) {
+	allowed := redirectURIs()
+	if redirectURI == "" {
+		redirectURI = allowed[0]
+	}
+	if !slices.Contains(allowed, redirectURI) {
+		return "", nil, errRedirectURINotAllowed
+	}
+
+	state, err := generateSecureToken()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := generateSecureToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	entry := &models.OAuthState{
+		ID:           hashToken(state),
+		Provider:     provider,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		RedirectURI:  redirectURI,
+		ExpiresAt:    time.Now().Add(cfg.Auth.OAuthStateTTL),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Abandoned sign-ins are dropped as new ones start
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return state, entry, nil
+}
+
+// consumeOAuthState looks up and deletes the pending sign-in for state, so each state is used at most once
+func consumeOAuthState(state, provider string) (*models.OAuthState, error) {
+	if state == "" {
+		return nil, errOAuthStateInvalid
+	}
+
+	var entry models.OAuthState
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", hashToken(state)).First(&entry).Error; err != nil {
+			return errOAuthStateInvalid
+		}
+
+		// Losing the delete to a concurrent callback means the state was already used
+		result := tx.Delete(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOAuthStateInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Provider != provider || !entry.ExpiresAt.After(time.Now()) {
+		return nil, errOAuthStateInvalid
+	}
+
+	return &entry, nil
+}
+
+// setOAuthStateCookie binds state to the browser; the cookie is only sent back to the auth routes
+func setOAuthStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, maxAge, "/api/v1/auth", "",
+		strings.HasPrefix(cfg.Server.PublicURL, "https://"), true)
+}
+
+// issueLoginCode stores a one-time code that the SPA at the redirect URI exchanges for tokens
+func issueLoginCode(user *models.User, provider string) (string, error) {
+	code, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.LoginCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.LoginCode{
+			ID:        hashToken(code),
+			UserID:    user.ID,
+			Provider:  provider,
+			ExpiresAt: time.Now().Add(cfg.Auth.LoginCodeTTL),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// redeemLoginCode deletes a login code and returns it if it was still valid
+func redeemLoginCode(code string) (*models.LoginCode, error) {
+	var entry models.LoginCode
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", hashToken(code)).First(&entry).Error; err != nil {
+			return errLoginCodeInvalid
+		}
+
+		result := tx.Delete(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errLoginCodeInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.ExpiresAt.After(time.Now()) {
+		return nil, errLoginCodeInvalid
+	}
+
+	return &entry, nil
+}
+
+// handOff redirects the browser back to the SPA with the given query parameter
+func handOff(c *gin.Context, redirectURI, key, value string) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid redirect URI"})
+		return
+	}
+
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+
+	// Keep the code out of Referer headers sent by the SPA page
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Redirect(http.StatusFound, u.String())
+}
+
+// ExchangeLoginCode trades the one-time code from an OAuth sign-in for access and refresh tokens
+func ExchangeLoginCode(c *gin.Context) {
+	var req LoginCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := redeemLoginCode(req.Code)
+	if errors.Is(err, errLoginCodeInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem login code"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, entry.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login code"})
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	completeSignIn(c, &user, amrFederated, http.StatusOK)
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"mis-system/config"
+	"mis-system/database"
+	"mis-system/identity"
+	"mis-system/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"gorm.io/gorm"
+)
+
+var (
+	// errAccountDisabled is returned when a deactivated or deleted account tries to sign in
+	errAccountDisabled = errors.New("account is disabled")
+	// errEmailUnverified is returned when an unverified email would be linked or provisioned
+	errEmailUnverified = errors.New("identity provider has not verified the email")
+	// errIdentityMismatch is returned when the user is already linked to another account at the provider
+	errIdentityMismatch = errors.New("a different account at this provider is linked to the user")
+	// errIdentityTaken is returned when the external account is already linked to another user
+	errIdentityTaken = errors.New("external account is linked to another user")
+)
+
+// Scopes requested from providers that do not configure their own
+var defaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// newIdentityProviders builds the sign-in providers from the configuration.
+// Google uses fixed endpoints; the other providers are discovered from their issuer on first use.
+func newIdentityProviders(c *config.Config) *identity.Registry {
+	all := []*identity.Provider{
+		identity.New(identity.Config{
+			Name:         models.ProviderGoogle,
+			DisplayName:  "Google",
+			Issuer:       "https://accounts.google.com",
+			ExtraIssuers: []string{"accounts.google.com"},
+			ClientID:     c.Google.ClientID,
+			ClientSecret: c.Google.ClientSecret,
+			RedirectURL:  c.Google.RedirectURL,
+			Scopes:       defaultOIDCScopes,
+			ClockSkew:    c.Google.ClockSkew,
+			Metadata: &identity.Metadata{
+				Issuer:                "https://accounts.google.com",
+				AuthorizationEndpoint: google.Endpoint.AuthURL,
+				TokenEndpoint:         google.Endpoint.TokenURL,
+				UserinfoEndpoint:      "https://openidconnect.googleapis.com/v1/userinfo",
+				JWKSURI:               c.Google.JWKSURL,
+				SigningAlgorithms:     []string{"RS256"},
+			},
+		}),
+	}
+
+	for name, p := range c.OIDC.Providers {
+		scopes := p.Scopes
+		if len(scopes) == 0 {
+			scopes = defaultOIDCScopes
+		}
+		redirectURL := p.RedirectURL
+		if redirectURL == "" {
+			redirectURL = strings.TrimSuffix(c.Server.PublicURL, "/") + "/api/v1/auth/oidc/" + name + "/callback"
+		}
+
+		all = append(all, identity.New(identity.Config{
+			Name:         name,
+			DisplayName:  p.DisplayName,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+			TrustEmail:   p.TrustEmail,
+			ClockSkew:    c.OIDC.ClockSkew,
+		}))
+	}
+
+	return identity.NewRegistry(all...)
+}
+
+// GetIdentityProviders lists the providers users can sign in with
+func GetIdentityProviders(c *gin.Context) {
+	list := make([]gin.H, 0)
+	for _, p := range providers.All() {
+		list = append(list, gin.H{
+			"name":         p.Name(),
+			"display_name": p.DisplayName(),
+			"login_url":    "/api/v1/auth/oidc/" + p.Name() + "/login",
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// OIDCLogin initiates the authorization code flow with the provider named in the route
+func OIDCLogin(c *gin.Context) {
+	oidcLogin(c, c.Param("provider"))
+}
+
+// OIDCCallback handles the authorization code callback from the provider named in the route
+func OIDCCallback(c *gin.Context) {
+	oidcCallback(c, c.Param("provider"))
+}
+
+// oidcLogin redirects the browser to the provider's authorization page.
+// The request is protected by a single-use server-side state, a PKCE challenge and an ID token nonce.
+func oidcLogin(c *gin.Context, name string) {
+	provider, ok := providers.Get(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	state, entry, err := beginOAuthState(name, c.Query("redirect_uri"))
+	if errors.Is(err, errRedirectURINotAllowed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redirect_uri is not allowed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate state"})
+		return
+	}
+
+	url, err := provider.AuthCodeURL(c.Request.Context(), state,
+		oauth2.S256ChallengeOption(entry.CodeVerifier),
+		oauth2.SetAuthURLParam("nonce", entry.Nonce),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	setOAuthStateCookie(c, state, int(cfg.Auth.OAuthStateTTL.Seconds()))
+
+	c.Redirect(http.StatusFound, url)
+}
+
+// oidcCallback redeems the authorization code, signs the user in and hands a one-time login code
+// to the SPA. Once the state is validated, failures are reported to the SPA as an error parameter.
+func oidcCallback(c *gin.Context, name string) {
+	provider, ok := providers.Get(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	// The state must come back to the browser that started the sign-in
+	state := c.Query("state")
+	stateCookie, err := c.Cookie(oauthStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(stateCookie), []byte(state)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state parameter"})
+		return
+	}
+	setOAuthStateCookie(c, "", -1)
+
+	entry, err := consumeOAuthState(state, name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state parameter"})
+		return
+	}
+
+	// The user declined or the provider refused the request
+	if c.Query("error") != "" {
+		handOff(c, entry.RedirectURI, "error", "access_denied")
+		return
+	}
+
+	// Exchange authorization code for a verified ID token
+	profile, err := provider.Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(entry.CodeVerifier))
+	if err != nil {
+		handOff(c, entry.RedirectURI, "error", "provider_error")
+		return
+	}
+
+	// The ID token must answer this sign-in, not a replayed one
+	if subtle.ConstantTimeCompare([]byte(profile.Nonce), []byte(entry.Nonce)) != 1 {
+		handOff(c, entry.RedirectURI, "error", "invalid_nonce")
+		return
+	}
+
+	// Accounts are matched and provisioned by email
+	if profile.Email == "" {
+		handOff(c, entry.RedirectURI, "error", "email_missing")
+		return
+	}
+
+	user, err := signInWithProfile(c, profile)
+	if err != nil {
+		handOff(c, entry.RedirectURI, "error", signInErrorCode(err))
+		return
+	}
+
+	code, err := issueLoginCode(user, name)
+	if err != nil {
+		handOff(c, entry.RedirectURI, "error", "server_error")
+		return
+	}
+
+	handOff(c, entry.RedirectURI, "code", code)
+}
+
+// signInWithProfile signs in the user linked to an external identity.
+// Unknown identities are linked to the user with the same verified email, or a new user is provisioned.
+func signInWithProfile(c *gin.Context, profile *identity.Profile) (*models.User, error) {
+	action := models.ActionOIDCAuth
+	if profile.Provider == models.ProviderGoogle {
+		action = models.ActionGoogleAuth
+	}
+
+	// Look for the user by linked identity, then by email
+	var user models.User
+	var link models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", profile.Provider, profile.Subject).First(&link).Error
+	switch {
+	case err == nil:
+		if err := database.DB.First(&user, link.UserID).Error; err != nil {
+			// The linked user has been deleted
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errAccountDisabled
+			}
+			return nil, err
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Emails are only trusted for linking and provisioning once the provider has verified them
+		if !profile.EmailVerified {
+			return nil, errEmailUnverified
+		}
+		if err := database.DB.Where("email = ?", profile.Email).First(&user).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// Create new user if not found
+	if user.ID == 0 {
+		// Emails of recently deleted accounts stay reserved
+		if err := releaseDeletedEmail(profile.Email); err != nil {
+			return nil, err
+		}
+
+		// Auto-provision a new user linked to the identity
+		names := strings.Fields(profile.Name)
+		firstName := profile.GivenName
+		lastName := profile.FamilyName
+
+		// Fallback to parsed name if given/family name not provided
+		if firstName == "" && len(names) > 0 {
+			firstName = names[0]
+		}
+		if lastName == "" && len(names) > 1 {
+			lastName = strings.Join(names[1:], " ")
+		}
+
+		user = models.User{
+			Email:            profile.Email,
+			FirstName:        firstName,
+			LastName:         lastName,
+			HasLocalPassword: false,
+			IsActive:         true,
+			IsAdmin:          false,
+			Roles:            models.Roles{models.RoleUser}, // Default role
+			LastLogin:        time.Now(),
+		}
+
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			_, err := linkIdentity(tx, &user, profile)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		// Create audit log for new user
+		createAuthAudit(c, user.ID, models.ActionRegister, true, providerDisplayName(profile.Provider)+" account auto-provisioned")
+	} else if !user.IsActive {
+		createAuthAudit(c, user.ID, action, false, "Account is disabled")
+		return nil, errAccountDisabled
+	} else {
+		// Link the identity to the user with the same verified email
+		if link.ID == 0 {
+			if _, err := linkIdentity(database.DB, &user, profile); err != nil {
+				if errors.Is(err, errIdentityMismatch) {
+					createAuthAudit(c, user.ID, models.ActionIdentityLink, false, "A different "+providerDisplayName(profile.Provider)+" account is already linked")
+				}
+				return nil, err
+			}
+			createAuthAudit(c, user.ID, models.ActionIdentityLink, true, providerDisplayName(profile.Provider)+" account "+profile.Email+" linked on sign-in")
+		} else if err := database.DB.Model(&link).Update("last_used_at", time.Now()).Error; err != nil {
+			return nil, err
+		} else if err := verifyEmailFromProvider(database.DB, &user, profile); err != nil {
+			return nil, err
+		}
+
+		// Update existing user with the provider's info
+		user.LastLogin = time.Now()
+
+		// Only update name if previously empty
+		if user.FirstName == "" && profile.GivenName != "" {
+			user.FirstName = profile.GivenName
+		}
+		if user.LastName == "" && profile.FamilyName != "" {
+			user.LastName = profile.FamilyName
+		}
+
+		if err := database.DB.Model(&user).Updates(map[string]interface{}{
+			"last_login": user.LastLogin,
+			"first_name": user.FirstName,
+			"last_name":  user.LastName,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// Create auth audit log
+	createAuthAudit(c, user.ID, action, true, providerDisplayName(profile.Provider))
+
+	return &user, nil
+}
+
+// linkIdentity links the external account described by profile to user.
+// Linking the same account again is a no-op.
+func linkIdentity(tx *gorm.DB, user *models.User, profile *identity.Profile) (*models.UserIdentity, error) {
+	var existing []models.UserIdentity
+	if err := tx.Where("provider = ? AND (user_id = ? OR subject = ?)", profile.Provider, user.ID, profile.Subject).
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range existing {
+		switch {
+		case existing[i].UserID == user.ID && existing[i].Subject == profile.Subject:
+			return &existing[i], nil
+		case existing[i].UserID == user.ID:
+			return nil, errIdentityMismatch
+		default:
+			return nil, errIdentityTaken
+		}
+	}
+
+	link := models.UserIdentity{
+		UserID:     user.ID,
+		Provider:   profile.Provider,
+		Subject:    profile.Subject,
+		Email:      profile.Email,
+		LastUsedAt: time.Now(),
+	}
+	if err := tx.Create(&link).Error; err != nil {
+		return nil, err
+	}
+	if err := verifyEmailFromProvider(tx, user, profile); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// providerDisplayName returns the human-readable name of a provider for messages and audit logs
+func providerDisplayName(name string) string {
+	if provider, ok := providers.Get(name); ok {
+		return provider.DisplayName()
+	}
+	return name
+}
+
+// signInErrorCode returns the error parameter handed to the SPA for a failed external sign-in
+func signInErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errAccountDisabled):
+		return "account_disabled"
+	case errors.Is(err, errEmailUnverified):
+		return "email_unverified"
+	case errors.Is(err, errIdentityMismatch), errors.Is(err, errIdentityTaken):
+		return "identity_conflict"
+	case errors.Is(err, errEmailReserved):
+		return "email_unavailable"
+	default:
+		return "server_error"
+	}
+}
+
+// respondSignInError writes the response for a failed external sign-in
+func respondSignInError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+	case errors.Is(err, errEmailUnverified):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address is not verified by the identity provider"})
+	case errors.Is(err, errIdentityMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "This account is linked to a different account at the identity provider"})
+	case errors.Is(err, errIdentityTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "This external account is already linked to another user"})
+	case errors.Is(err, errEmailReserved):
+		respondEmailUnavailable(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Sign-in failed"})
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"mis-system/database"
+	"mis-system/models"
+	"mis-system/webauthn"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxPasskeysPerUser bounds how many passkeys one account can register
+const maxPasskeysPerUser = 20
+
+// RegisterPasskeyRequest defines the structure for completing a passkey registration
+type RegisterPasskeyRequest struct {
+	Ceremony   string                         `json:"ceremony" binding:"required"`
+	Name       string                         `json:"name" binding:"max=64"`
+	Credential *webauthn.RegistrationResponse `json:"credential" binding:"required"`
+	StepUpRequest
+}
+
+// RenamePasskeyRequest defines the structure for renaming a passkey
+type RenamePasskeyRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// GetMyPasskeys lists the current user's passkeys
+func GetMyPasskeys(c *gin.Context) {
+	var credentials []models.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", c.GetUint("userID")).
+		Order("created_at").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": credentials})
+}
+
+// GetMyPasskeyOptions starts registering a passkey for the current user, returning the options for navigator.credentials.create
+func GetMyPasskeyOptions(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Authenticators that already hold a passkey for the account are asked not to create another
+	var credentials []models.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+	if len(credentials) >= maxPasskeysPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "Remove a passkey before adding another"})
+		return
+	}
+
+	ceremony, challenge, err := issuePasskeyCeremony(passkeyRegistrationAudience, strconv.FormatUint(uint64(user.ID), 10))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	account := webauthn.User{
+		ID:          passkeyUserHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+	}
+	if account.DisplayName == "" {
+		account.DisplayName = user.Email
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"ceremony":  ceremony,
+		"publicKey": relyingParty.CreationOptions(account, challenge, passkeyDescriptors(credentials)),
+	}})
+}
+
+// RegisterMyPasskey verifies a new passkey created by the browser and stores it for the current user
+func RegisterMyPasskey(c *gin.Context) {
+	var req RegisterPasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+
+	// The ceremony must have been started by the same user
+	claims, err := parsePasskeyCeremony(req.Ceremony, passkeyRegistrationAudience)
+	if err != nil || claims.Subject != strconv.FormatUint(uint64(userID), 10) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// A passkey is a lasting way into the account, so a stolen access token alone must not be enough to add one
+	if !checkStepUp(c, &user, &req.StepUpRequest, models.ActionPasskeyAdd, "add a passkey") {
+		return
+	}
+
+	registered, err := relyingParty.VerifyRegistration(req.Credential, claims.Challenge)
+	if err != nil {
+		createAuthAudit(c, userID, models.ActionPasskeyAdd, false, "Passkey verification failed: "+err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	credential := models.WebAuthnCredential{
+		UserID:         userID,
+		CredentialID:   webauthn.Base64URL(registered.ID).String(),
+		PublicKey:      registered.PublicKey,
+		SignCount:      registered.SignCount,
+		Transports:     strings.Join(registered.Transports, ","),
+		BackupEligible: registered.BackupEligible,
+		BackedUp:       registered.BackedUp,
+		Name:           name,
+	}
+	if !bytes.Equal(registered.AAGUID, make([]byte, len(registered.AAGUID))) {
+		credential.AAGUID = hex.EncodeToString(registered.AAGUID)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := consumePasskeyCeremony(tx, claims); err != nil {
+			return err
+		}
+
+		var existing int64
+		if err := tx.Model(&models.WebAuthnCredential{}).
+			Where("credential_id = ?", credential.CredentialID).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return errPasskeyRegistered
+		}
+
+		return tx.Create(&credential).Error
+	})
+	switch {
+	case errors.Is(err, errPasskeyCeremonyInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	case errors.Is(err, errPasskeyRegistered):
+		c.JSON(http.StatusConflict, gin.H{"error": "This passkey is already registered"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, userID, models.ActionPasskeyAdd, true, "Passkey "+credential.Name+" added")
+
+	c.JSON(http.StatusCreated, gin.H{"data": credential})
+}
+
+// RenameMyPasskey changes the name of one of the current user's passkeys
+func RenameMyPasskey(c *gin.Context) {
+	var req RenamePasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var credential models.WebAuthnCredential
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("userID")).
+		First(&credential).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	if err := database.DB.Model(&credential).Update("name", strings.TrimSpace(req.Name)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": credential})
+}
+
+// DeleteMyPasskey removes one of the current user's passkeys
+func DeleteMyPasskey(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Preload("Identities").First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var credential models.WebAuthnCredential
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).
+		First(&credential).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	// Never leave the account without a way to sign in
+	methods, err := signInMethods(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove passkey"})
+		return
+	}
+	if methods <= 1 {
+		createAuthAudit(c, user.ID, models.ActionPasskeyRemove, false, "Passkey "+credential.Name+" is the only sign-in method")
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a password before removing this passkey; it is your only sign-in method"})
+		return
+	}
+
+	if err := database.DB.Delete(&credential).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove passkey"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionPasskeyRemove, true, "Passkey "+credential.Name+" removed")
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// signInMethods counts the ways a user can sign in: a password, linked accounts and passkeys.
+// The user must be loaded with its identities.
+func signInMethods(user *models.User) (int64, error) {
+	var passkeys int64
+	if err := database.DB.Model(&models.WebAuthnCredential{}).
+		Where("user_id = ?", user.ID).Count(&passkeys).Error; err != nil {
+		return 0, err
+	}
+
+	methods := passkeys + int64(len(user.Identities))
+	if user.HasLocalPassword {
+		methods++
+	}
+
+	return methods, nil
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mis-system/config"
+	"mis-system/database"
+	"mis-system/models"
+	"mis-system/passwordpolicy"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// passwordChangeAudience marks tokens letting a user whose password expired choose a new one during sign-in
+const passwordChangeAudience = "password-change"
+
+// passwordChangeTTL is how long a user has to replace an expired password after entering it
+const passwordChangeTTL = 10 * time.Minute
+
+var errPasswordChangeInvalid = errors.New("invalid or expired password change token")
+
+// Rules new passwords are checked against; Configure adds the breached password list
+var passwords = newPasswordPolicy(cfg, nil)
+
+// ChangePasswordRequest defines the structure for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ExpiredPasswordRequest defines the structure for replacing an expired password during sign-in
+type ExpiredPasswordRequest struct {
+	PasswordChangeToken string `json:"password_change_token" binding:"required"`
+	NewPassword         string `json:"new_password" binding:"required"`
+}
+
+// newPasswordPolicy builds the password rules from the configuration; breached may be nil
+func newPasswordPolicy(c *config.Config, breached *passwordpolicy.BreachedList) *passwordpolicy.Policy {
+	return &passwordpolicy.Policy{
+		MinLength:        c.PasswordPolicy.MinLength,
+		MaxLength:        c.PasswordPolicy.MaxLength,
+		RequireUppercase: c.PasswordPolicy.RequireUppercase,
+		RequireLowercase: c.PasswordPolicy.RequireLowercase,
+		RequireDigit:     c.PasswordPolicy.RequireDigit,
+		RequireSymbol:    c.PasswordPolicy.RequireSymbol,
+		Breached:         breached,
+	}
+}
+
+// GetPasswordPolicy returns the rules new passwords must satisfy, so clients can show them up front
+func GetPasswordPolicy(c *gin.Context) {
+	policy := cfg.PasswordPolicy
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"min_length":        policy.MinLength,
+		"max_length":        policy.MaxLength,
+		"require_uppercase": policy.RequireUppercase,
+		"require_lowercase": policy.RequireLowercase,
+		"require_digit":     policy.RequireDigit,
+		"require_symbol":    policy.RequireSymbol,
+		"history":           policy.History,
+		"max_age":           int(policy.MaxAge.Seconds()), // Seconds; 0 when passwords never expire
+		"check_breached":    passwords.Breached != nil,
+	}})
+}
+
+// ChangeMyPassword replaces the current user's password after checking the current one.
+// Every session and access token of the user is revoked; the caller stays signed in with new tokens
+// issued in the same session family.
+func ChangeMyPassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.HasLocalPassword || user.Password == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This account does not have a password"})
+		return
+	}
+
+	var current models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.GetUint("sessionID"), user.ID).
+		First(&current).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	// Guessing the current password counts against the same lockout as password logins
+	accountKey := accountThrottleKey(user.Email)
+	wait, err := throttle.Wait(accountKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		respondLoginThrottled(c, wait)
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		createAuthAudit(c, user.ID, models.ActionPasswordChange, false, "Invalid current password")
+		if attempt, _, err := throttle.Fail(accountKey, cfg.Login.FreeAttempts, cfg.Login.AccountLockout); err == nil {
+			if wait := attemptWait(attempt); wait > 0 {
+				setRetryAfter(c, wait)
+			}
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if !checkNewPassword(c, &user, req.NewPassword) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+		return
+	}
+
+	var revoked int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, &user, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		var err error
+		revoked, err = revokeSessions(tx, "user_id = ? AND id <> ?", user.ID, current.ID)
+		if err != nil {
+			return err
+		}
+
+		// Tokens issued before the change stop working everywhere, including the caller's own
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionPasswordChange, true,
+		fmt.Sprintf("Password changed; revoked %d other session(s)", revoked))
+
+	sendPasswordChangedMail(c, &user)
+
+	// Keep the caller signed in with a new session in the same family
+	tokenResponse, err := rotateTokens(c, &user, &current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate new tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse)
+}
+
+// ChangeExpiredPassword replaces a password that expired, using the token from the refused login, and completes the sign-in.
+// Existing sessions are revoked, and users with a second factor get a challenge as usual.
+func ChangeExpiredPassword(c *gin.Context) {
+	var req ExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := parsePasswordChangeToken(req.PasswordChangeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired password change token"})
+		return
+	}
+
+	// The token is only good while the expired password is still in place
+	var user models.User
+	if err := database.DB.First(&user, claims.Subject).Error; err != nil || !passwordExpired(&user) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired password change token"})
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	if !checkNewPassword(c, &user, req.NewPassword) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+		return
+	}
+
+	// Use up the token, update the password and revoke existing sessions together
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := denylist.Consume(tx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errPasswordChangeInvalid
+		}
+
+		if err := setPassword(tx, &user, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		return revokeUserSessions(tx, user.ID)
+	})
+	if errors.Is(err, errPasswordChangeInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired password change token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionPasswordChange, true, "Expired password changed")
+
+	sendPasswordChangedMail(c, &user)
+
+	// Update last login time
+	user.LastLogin = time.Now()
+	database.DB.Model(&user).Update("last_login", user.LastLogin)
+
+	// Create audit log for successful login
+	createAuthAudit(c, user.ID, models.ActionLogin, true, "")
+
+	// Return tokens, or a challenge when a second factor is needed
+	completeSignIn(c, &user, amrPassword, http.StatusOK)
+}
+
+// checkNewPassword checks a password about to be set against the policy and, for an existing user, their recent passwords.
+// It responds with the violations and reports whether the password may be used.
+func checkNewPassword(c *gin.Context, user *models.User, password string) bool {
+	violations := passwords.Check(password)
+
+	if user != nil {
+		reused, err := passwordReused(user, password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check password history"})
+			return false
+		}
+		if reused {
+			violations = append(violations, passwordpolicy.Violation{
+				Code:    passwordpolicy.CodeReused,
+				Message: fmt.Sprintf("Password must differ from your last %d passwords", cfg.PasswordPolicy.History),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": violations,
+		})
+		return false
+	}
+
+	return true
+}
+
+// passwordReused reports whether password is the user's current password or one of the last password_policy.history they set
+func passwordReused(user *models.User, password string) (bool, error) {
+	if cfg.PasswordPolicy.History == 0 {
+		return false, nil
+	}
+
+	var history []models.PasswordHistory
+	if err := database.DB.Where("user_id = ?", user.ID).
+		Order("id DESC").Limit(cfg.PasswordPolicy.History).Find(&history).Error; err != nil {
+		return false, err
+	}
+
+	// Passwords set before the history was kept are only known from the user
+	var hashes []string
+	if user.HasLocalPassword && user.Password != "" {
+		hashes = append(hashes, user.Password)
+	}
+	for _, entry := range history {
+		if !slices.Contains(hashes, entry.Password) {
+			hashes = append(hashes, entry.Password)
+		}
+	}
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setPassword stores a new password hash for the user, restarting its age and recording it in the password history
+func setPassword(tx *gorm.DB, user *models.User, hash string) error {
+	now := time.Now()
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":           hash,
+		"has_local_password": true,
+		"password_set_at":    now,
+	}).Error; err != nil {
+		return err
+	}
+	user.Password = hash
+	user.HasLocalPassword = true
+	user.PasswordSetAt = now
+
+	return recordPasswordHistory(tx, user.ID, hash)
+}
+
+// recordPasswordHistory remembers a password hash the user just set, keeping only the last password_policy.history
+func recordPasswordHistory(tx *gorm.DB, userID uint, hash string) error {
+	if cfg.PasswordPolicy.History == 0 {
+		return nil
+	}
+
+	if err := tx.Create(&models.PasswordHistory{UserID: userID, Password: hash}).Error; err != nil {
+		return err
+	}
+
+	recent := tx.Model(&models.PasswordHistory{}).Select("id").
+		Where("user_id = ?", userID).Order("id DESC").Limit(cfg.PasswordPolicy.History)
+	return tx.Where("user_id = ? AND id NOT IN (?)", userID, recent).Delete(&models.PasswordHistory{}).Error
+}
+
+// passwordExpired reports whether the user's password is older than password_policy.max_age
+func passwordExpired(user *models.User) bool {
+	return cfg.PasswordPolicy.MaxAge > 0 && user.HasLocalPassword && !user.PasswordSetAt.IsZero() &&
+		time.Since(user.PasswordSetAt) > cfg.PasswordPolicy.MaxAge
+}
+
+// respondPasswordExpired refuses a password login whose password expired, handing out a token to replace it with
+func respondPasswordExpired(c *gin.Context, user *models.User) {
+	token, err := issuePasswordChangeToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	createAuthAudit(c, user.ID, models.ActionLogin, false, "Password expired")
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":                 "Your password has expired. Choose a new one to continue",
+		"password_expired":      true,
+		"password_change_token": token,
+		"expires_in":            int(passwordChangeTTL.Seconds()),
+	})
+}
+
+// issuePasswordChangeToken signs a short-lived, single-use token letting the user replace their expired password
+func issuePasswordChangeToken(user *models.User) (string, error) {
+	claims := internalClaims(passwordChangeAudience, strconv.FormatUint(uint64(user.ID), 10), passwordChangeTTL)
+	return signInternalToken(passwordChangeAudience, &claims)
+}
+
+// parsePasswordChangeToken validates a password change token and returns its claims
+func parsePasswordChangeToken(token string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	err := parseInternalToken(token, passwordChangeAudience, claims)
+	if err != nil || claims.Subject == "" || claims.ID == "" {
+		return nil, errPasswordChangeInvalid
+	}
+
+	return claims, nil
+}
+
+// sendPasswordChangedMail tells the user their password changed, in case it was not them
+func sendPasswordChangedMail(c *gin.Context, user *models.User) {
+	sendMail(user.Email, "password_changed", gin.H{
+		"FirstName": user.FirstName,
+		"Time":      time.Now().UTC().Format(time.RFC1123),
+		"IPAddress": c.ClientIP(),
+	})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChangeMyPassword(t *testing.T) {
+	const oldPassword = "old password 1"
+
+	tests := []struct {
+		name        string
+		current     string // Current password sent with the request
+		wantStatus  int
+		wantRevoked bool // Tokens issued before the request stop working
+	}{
+		{"correct current password", oldPassword, http.StatusOK, true},
+		{"wrong current password", "not my password 2", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "change@example.com", oldPassword)
+			tokens := signIn(t, user)
+			other := signIn(t, user) // Another device, which a thief holding the old password might be using
+
+			claims, err := parseClaims(tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := performJSON(ChangeMyPassword, http.MethodPost, ChangePasswordRequest{
+				CurrentPassword: tt.current,
+				NewPassword:     "brand new horse 7",
+			}, func(c *gin.Context) {
+				c.Set("userID", claims.UserID)
+				c.Set("sessionID", claims.SessionID)
+				c.Set("claims", claims)
+			})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			wantOld := http.StatusOK
+			if tt.wantRevoked {
+				wantOld = http.StatusUnauthorized
+			}
+			if status := authenticate(other.AccessToken); status != wantOld {
+				t.Errorf("other device access token: status = %d, want %d", status, wantOld)
+			}
+			if status := authenticate(tokens.AccessToken); status != wantOld {
+				t.Errorf("caller's old access token: status = %d, want %d", status, wantOld)
+			}
+			if w := performJSON(RefreshToken, http.MethodPost, RefreshTokenRequest{other.RefreshToken}, nil); (w.Code == http.StatusOK) == tt.wantRevoked {
+				t.Errorf("other device refresh status = %d", w.Code)
+			}
+			if !tt.wantRevoked {
+				return
+			}
+
+			// The caller stays signed in with the tokens in the response
+			var renewed TokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &renewed); err != nil {
+				t.Fatal(err)
+			}
+			if status := authenticate(renewed.AccessToken); status != http.StatusOK {
+				t.Errorf("new access token: status = %d, want 200", status)
+			}
+			if w := performJSON(RefreshToken, http.MethodPost, RefreshTokenRequest{renewed.RefreshToken}, nil); w.Code != http.StatusOK {
+				t.Errorf("new refresh token: status = %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"errors"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ResetPasswordRequest defines the structure for password reset
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+var (
+	errResetTokenInvalid = errors.New("invalid reset token")
+	errResetTokenUsed    = errors.New("reset token already used")
+	errResetTokenExpired = errors.New("reset token expired")
+)
+
+// ForgotPassword initiates password reset
+func ForgotPassword(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if user exists
+	var user models.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		// Don't reveal whether the email exists or not
+		c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you'll receive password reset instructions"})
+		return
+	}
+
+	// Check if user has a local password
+	if !user.HasLocalPassword {
+		// For security, don't reveal that the user doesn't have a local password
+		c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you'll receive password reset instructions"})
+		return
+	}
+
+	// Generate and store a password reset token
+	token, err := issuePasswordResetToken(user.ID, cfg.Auth.PasswordResetTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create password reset token"})
+		return
+	}
+
+	// Send the reset link by email
+	sendMail(user.Email, "password_reset", gin.H{
+		"FirstName": user.FirstName,
+		"ActionURL": appURL("/reset-password", url.Values{"token": {token}, "email": {user.Email}}),
+		"ExpiresIn": formatDuration(cfg.Auth.PasswordResetTTL),
+	})
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionPasswordReset, true, "Password reset requested")
+
+	c.JSON(http.StatusOK, gin.H{"message": "If your email is registered, you'll receive password reset instructions"})
+}
+
+// ResetPassword handles password reset with token
+func ResetPassword(c *gin.Context) {
+	var input ResetPasswordRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate the reset token against stored tokens
+	resetToken, err := findPasswordResetToken(input.Token)
+	if err != nil {
+		if resetToken != nil {
+			createAuthAudit(c, resetToken.UserID, models.ActionPasswordReset, false, err.Error())
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	// Get the user
+	var user models.User
+	if err := database.DB.First(&user, resetToken.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	// The token stays usable when the password is refused, so the user can pick another
+	if !checkNewPassword(c, &user, input.NewPassword) {
+		return
+	}
+
+	// Hash the new password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+		return
+	}
+
+	// Consume the token, update the password and revoke existing sessions together
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := consumePasswordResetToken(tx, resetToken); err != nil {
+			return err
+		}
+
+		if err := setPassword(tx, &user, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		// The reset link was emailed to the user, so opening it proves they own the address
+		if !emailVerified(&user) {
+			if err := markEmailVerified(tx, &user); err != nil {
+				return err
+			}
+		}
+
+		return revokeUserSessions(tx, user.ID)
+	})
+	if errors.Is(err, errResetTokenUsed) {
+		createAuthAudit(c, user.ID, models.ActionPasswordReset, false, err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionPasswordReset, true, "Password reset completed")
+
+	// Notify the user that their password changed
+	sendPasswordChangedMail(c, &user)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// issuePasswordResetToken stores a new reset token for the user and returns its plaintext value.
+// Any outstanding tokens for the user are invalidated so only the latest link works.
+func issuePasswordResetToken(userID uint, ttl time.Duration) (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", userID).
+			Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    userID,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// findPasswordResetToken looks up a reset token and checks that it is still usable.
+// The token record is returned alongside expiry and reuse errors so callers can audit them.
+func findPasswordResetToken(token string) (*models.PasswordResetToken, error) {
+	var resetToken models.PasswordResetToken
+	if err := database.DB.Where("token_hash = ?", hashToken(token)).First(&resetToken).Error; err != nil {
+		return nil, errResetTokenInvalid
+	}
+
+	if !resetToken.UsedAt.IsZero() {
+		return &resetToken, errResetTokenUsed
+	}
+
+	if time.Now().After(resetToken.ExpiresAt) {
+		return &resetToken, errResetTokenExpired
+	}
+
+	return &resetToken, nil
+}
+
+// consumePasswordResetToken marks a reset token as used, failing if another request used it first
+func consumePasswordResetToken(tx *gorm.DB, resetToken *models.PasswordResetToken) error {
+	result := tx.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", resetToken.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errResetTokenUsed
+	}
+
+	return nil
+}
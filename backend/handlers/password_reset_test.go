@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resetTokenState prepares a stored reset token for a test case and returns the plaintext to present
+type resetTokenState func(t *testing.T, user *models.User) string
+
+func validResetToken(t *testing.T, user *models.User) string {
+	token, err := issuePasswordResetToken(user.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func expiredResetToken(t *testing.T, user *models.User) string {
+	token := validResetToken(t, user)
+	database.DB.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).
+		Update("expires_at", time.Now().Add(-time.Minute))
+	return token
+}
+
+func usedResetToken(t *testing.T, user *models.User) string {
+	token := validResetToken(t, user)
+	database.DB.Model(&models.PasswordResetToken{}).Where("user_id = ?", user.ID).
+		Update("used_at", time.Now())
+	return token
+}
+
+func unknownResetToken(t *testing.T, user *models.User) string {
+	validResetToken(t, user)
+	token, err := generateSecureToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestIssuePasswordResetToken(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "issue@example.com", "old password 1")
+
+	first, err := issuePasswordResetToken(user.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	second, err := issuePasswordResetToken(user.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("issue again: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"latest token is usable", second, nil},
+		{"earlier token is invalidated", first, errResetTokenInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := findPasswordResetToken(tt.token)
+			if err != tt.wantErr {
+				t.Errorf("findPasswordResetToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var stored models.PasswordResetToken
+	database.DB.Where("user_id = ?", user.ID).First(&stored)
+	if stored.TokenHash == second {
+		t.Error("reset token stored in plaintext")
+	}
+}
+
+func TestFindPasswordResetToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      resetTokenState
+		wantErr    error
+		wantRecord bool
+	}{
+		{"valid token", validResetToken, nil, true},
+		{"expired token", expiredResetToken, errResetTokenExpired, true},
+		{"reused token", usedResetToken, errResetTokenUsed, true},
+		{"unknown token", unknownResetToken, errResetTokenInvalid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "find@example.com", "old password 1")
+			token := tt.state(t, user)
+
+			record, err := findPasswordResetToken(token)
+			if err != tt.wantErr {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if (record != nil) != tt.wantRecord {
+				t.Errorf("record returned = %v, want %v", record != nil, tt.wantRecord)
+			}
+			if record != nil && record.UserID != user.ID {
+				t.Errorf("record user = %d, want %d", record.UserID, user.ID)
+			}
+		})
+	}
+}
+
+func TestConsumePasswordResetToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   resetTokenState
+		wantErr error
+	}{
+		{"valid token", validResetToken, nil},
+		{"expired token", expiredResetToken, nil}, // Expiry is checked by findPasswordResetToken
+		{"reused token", usedResetToken, errResetTokenUsed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "consume@example.com", "old password 1")
+			tt.state(t, user)
+
+			var record models.PasswordResetToken
+			database.DB.Where("user_id = ?", user.ID).First(&record)
+
+			if err := consumePasswordResetToken(database.DB, &record); err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			database.DB.First(&record, record.ID)
+			if record.UsedAt.IsZero() {
+				t.Error("token not marked as used")
+			}
+			if err := consumePasswordResetToken(database.DB, &record); err != errResetTokenUsed {
+				t.Errorf("second consume error = %v, want %v", err, errResetTokenUsed)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	const oldPassword = "old password 1"
+	const newPassword = "brand new horse 7"
+
+	tests := []struct {
+		name        string
+		state       resetTokenState
+		password    string
+		wantStatus  int
+		wantChanged bool
+	}{
+		{"valid token sets the new password", validResetToken, newPassword, http.StatusOK, true},
+		{"expired token", expiredResetToken, newPassword, http.StatusBadRequest, false},
+		{"reused token", usedResetToken, newPassword, http.StatusBadRequest, false},
+		{"unknown token", unknownResetToken, newPassword, http.StatusBadRequest, false},
+		{"password refused by the policy", validResetToken, "short", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "reset@example.com", oldPassword)
+			tokens := signIn(t, user) // A session the reset must end
+			token := tt.state(t, user)
+
+			w := performJSON(ResetPassword, http.MethodPost, ResetPasswordRequest{
+				Token:       token,
+				NewPassword: tt.password,
+			}, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var stored models.User
+			database.DB.First(&stored, user.ID)
+			changed := bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(tt.password)) == nil
+			if changed != tt.wantChanged {
+				t.Errorf("password changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed && bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(oldPassword)) != nil {
+				t.Error("old password no longer works after a refused reset")
+			}
+
+			var active, completed int64
+			database.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+			database.DB.Model(&models.AuthAudit{}).
+				Where("user_id = ? AND action = ? AND success = ?", user.ID, models.ActionPasswordReset, true).
+				Count(&completed)
+			wantAccess := http.StatusOK
+			if tt.wantChanged {
+				wantAccess = http.StatusUnauthorized
+			}
+			if (active == 0) != tt.wantChanged {
+				t.Errorf("active sessions = %d after the reset, want them revoked = %v", active, tt.wantChanged)
+			}
+			if status := authenticate(tokens.AccessToken); status != wantAccess {
+				t.Errorf("access token issued before the reset: status = %d, want %d", status, wantAccess)
+			}
+			if (completed == 1) != tt.wantChanged {
+				t.Errorf("successful password_reset audits = %d, want reset audited = %v", completed, tt.wantChanged)
+			}
+			if !tt.wantChanged {
+				return
+			}
+
+			if stored.PasswordSetAt.IsZero() || stored.EmailVerifiedAt.IsZero() {
+				t.Error("password_set_at and email_verified_at not recorded")
+			}
+
+			// The token can only be used once
+			w = performJSON(ResetPassword, http.MethodPost, ResetPasswordRequest{
+				Token:       token,
+				NewPassword: "another new horse 8",
+			}, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("second reset status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// roleNamePattern restricts custom role names to lowercase identifiers
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// CreateRoleRequest defines the structure for creating a custom role
+type CreateRoleRequest struct {
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+	RequireMFA  bool                `json:"require_mfa"`
+}
+
+// UpdateRolePermissionsRequest defines the structure for replacing a role's permissions
+type UpdateRolePermissionsRequest struct {
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+}
+
+// GetAllRoles lists every role with its permissions
+func GetAllRoles(c *gin.Context) {
+	var roles []models.RoleDefinition
+	if err := database.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": roles})
+}
+
+// GetAllPermissions lists every permission that can be granted to a role
+func GetAllPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": models.AllPermissions})
+}
+
+// CreateRole creates a custom role
+func CreateRole(c *gin.Context) {
+	var input CreateRoleRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !roleNamePattern.MatchString(input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name must be 2-50 lowercase letters, digits, '_' or '-' and start with a letter"})
+		return
+	}
+	if err := validatePermissions(input.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check if role already exists
+	var existing models.RoleDefinition
+	if err := database.DB.Where("name = ?", input.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	role := models.RoleDefinition{
+		Name:        models.Role(input.Name),
+		Description: input.Description,
+		RequireMFA:  input.RequireMFA,
+		Permissions: rolePermissions(input.Permissions),
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	createAuthAudit(c, c.GetUint("userID"), models.ActionRoleUpdate, true,
+		fmt.Sprintf("Role %s created with permissions [%s]", role.Name, joinPermissions(input.Permissions)))
+
+	c.JSON(http.StatusCreated, gin.H{"data": role})
+}
+
+// UpdateRolePermissions replaces the permissions granted to a role
+func UpdateRolePermissions(c *gin.Context) {
+	var role models.RoleDefinition
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if role.Name == models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The admin role always holds every permission"})
+		return
+	}
+
+	var input UpdateRolePermissionsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePermissions(input.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Replace the role's permissions
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_definition_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+
+		grants := rolePermissions(input.Permissions)
+		for i := range grants {
+			grants[i].RoleDefinitionID = role.ID
+		}
+		if len(grants) > 0 {
+			if err := tx.Create(&grants).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&role).Update("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+		return
+	}
+
+	createAuthAudit(c, c.GetUint("userID"), models.ActionRoleUpdate, true,
+		fmt.Sprintf("Role %s permissions set to [%s]", role.Name, joinPermissions(input.Permissions)))
+
+	database.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, gin.H{"data": role})
+}
+
+// DeleteRole removes a custom role that is no longer assigned to any user
+func DeleteRole(c *gin.Context) {
+	var role models.RoleDefinition
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	// Refuse to delete roles that are still assigned
+	var assigned int64
+	if err := database.DB.Model(&models.User{}).
+		Where("EXISTS (SELECT 1 FROM json_each(users.roles) WHERE json_each.value = ?)", role.Name).
+		Count(&assigned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role assignments"})
+		return
+	}
+	if assigned > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Role is still assigned to %d user(s)", assigned)})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_definition_id = ?", role.ID).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	createAuthAudit(c, c.GetUint("userID"), models.ActionRoleUpdate, true, fmt.Sprintf("Role %s deleted", role.Name))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// validateRoles checks that every role exists
+func validateRoles(roles models.Roles) error {
+	roles = uniqueRoles(roles)
+	if len(roles) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.RoleDefinition{}).
+		Where("name IN ?", []models.Role(roles)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+
+	if int(count) != len(roles) {
+		return errors.New("one or more roles do not exist")
+	}
+
+	return nil
+}
+
+// validatePermissions checks that every permission is known
+func validatePermissions(permissions []models.Permission) error {
+	for _, p := range permissions {
+		if !p.IsValid() {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+	}
+	return nil
+}
+
+// rolePermissions converts permissions into role grants, dropping duplicates
+func rolePermissions(permissions []models.Permission) []models.RolePermission {
+	seen := make(map[models.Permission]bool)
+	grants := make([]models.RolePermission, 0, len(permissions))
+	for _, p := range permissions {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		grants = append(grants, models.RolePermission{Permission: p})
+	}
+	return grants
+}
+
+// uniqueRoles returns roles without duplicates, preserving order
+func uniqueRoles(roles models.Roles) models.Roles {
+	seen := make(map[models.Role]bool)
+	unique := make(models.Roles, 0, len(roles))
+	for _, r := range roles {
+		if !seen[r] {
+			seen[r] = true
+			unique = append(unique, r)
+		}
+	}
+	return unique
+}
+
+// joinPermissions formats permissions for audit details
+func joinPermissions(permissions []models.Permission) string {
+	names := make([]string, len(permissions))
+	for i, p := range permissions {
+		names[i] = string(p)
+	}
+	return strings.Join(names, ", ")
+}
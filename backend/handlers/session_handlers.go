@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SessionResponse describes an active session, flagging the one making the request
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// GetMySessions lists the current user's active sessions
+func GetMySessions(c *gin.Context) {
+	listSessions(c, c.GetUint("userID"))
+}
+
+// RevokeMySession revokes one of the current user's sessions
+func RevokeMySession(c *gin.Context) {
+	revokeSession(c, c.GetUint("userID"), c.Param("id"))
+}
+
+// RevokeMyOtherSessions revokes every session of the current user except the one making the request
+func RevokeMyOtherSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	currentID := c.GetUint("sessionID")
+
+	var revoked int64
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = revokeSessions(tx, "user_id = ? AND id <> ?", userID, currentID)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, userID, models.ActionSessionRevoke, true,
+		fmt.Sprintf("Revoked %d other session(s)", revoked))
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"revoked": revoked}})
+}
+
+// RevokeAllMySessions revokes every session of the current user, including the one making the request,
+// and invalidates all of their access tokens
+func RevokeAllMySessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, userID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, userID, models.ActionSessionRevoke, true, "All sessions revoked")
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// GetUserSessions lists a user's active sessions for administrators
+func GetUserSessions(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	listSessions(c, user.ID)
+}
+
+// RevokeUserSession revokes one of a user's sessions for administrators
+func RevokeUserSession(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	revokeSession(c, user.ID, c.Param("sid"))
+}
+
+// RevokeAllUserSessions revokes every session of a user for administrators
+func RevokeAllUserSessions(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, user.ID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionSessionRevoke, true,
+		fmt.Sprintf("All sessions revoked by user %d", c.GetUint("userID")))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// listSessions writes the active sessions of a user
+func listSessions(c *gin.Context, userID uint) {
+	var sessions []models.Session
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sessions"})
+		return
+	}
+
+	// Only the caller's own session can be current
+	currentID := uint(0)
+	if userID == c.GetUint("userID") {
+		currentID = c.GetUint("sessionID")
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{Session: session, Current: session.ID == currentID}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// revokeSession revokes a single active session belonging to userID
+func revokeSession(c *gin.Context, userID uint, sessionID string) {
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := revokeSessions(tx, "id = ?", session.ID)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, userID, models.ActionSessionRevoke, true,
+		fmt.Sprintf("Session %d (device %s) revoked by user %d", session.ID, session.DeviceID, c.GetUint("userID")))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// findUserParam loads the user named by the :id route parameter, writing a 404 when missing
+func findUserParam(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	return &user, true
+}
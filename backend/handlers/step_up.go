@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// stepUpMaxAge is how recent a sign-in must be for a sensitive change to an account with neither a password nor an
+// authenticator app to check again
+const stepUpMaxAge = 5 * time.Minute
+
+// StepUpRequest carries the proof that the account holder is present, which sensitive changes to an account ask for
+type StepUpRequest struct {
+	CurrentPassword string `json:"current_password"`
+	MFACodeRequest
+}
+
+// checkStepUp makes sure the account holder, and not just someone holding their access token, makes a sensitive
+// change. A session that used two factors is enough; otherwise users with an authenticator app enter a code or a
+// recovery code, users with a password enter it, and the rest must have signed in within stepUpMaxAge.
+// Failures are audited under action and explained as being needed to do what purpose describes.
+func checkStepUp(c *gin.Context, user *models.User, req *StepUpRequest, action models.AuditAction, purpose string) bool {
+	if claims, ok := currentClaims(c); ok && slices.Contains(claims.AMR, amrMFA) {
+		return true
+	}
+
+	hasTOTP, err := hasConfirmedTOTP(database.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check two-factor authentication"})
+		return false
+	}
+
+	switch {
+	case hasTOTP:
+		// The password is not enough here: it would let a stolen password undo the authenticator app
+		if req.Code == "" && req.RecoveryCode == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Enter a code from your authenticator app to " + purpose})
+			return false
+		}
+		if !checkMFAThrottle(c, user.ID) {
+			return false
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := verifySecondFactor(tx, user.ID, req.MFACodeRequest)
+			return err
+		})
+		return respondMFAError(c, user.ID, err, "Failed to check two-factor authentication")
+
+	case user.HasLocalPassword && user.Password != "":
+		if req.CurrentPassword == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Enter your current password to " + purpose})
+			return false
+		}
+
+		// Guessing the password counts against the same lockout as password logins
+		accountKey := accountThrottleKey(user.Email)
+		wait, err := throttle.Wait(accountKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+			return false
+		}
+		if wait > 0 {
+			respondLoginThrottled(c, wait)
+			return false
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+			createAuthAudit(c, user.ID, action, false, "Invalid current password")
+			if attempt, _, err := throttle.Fail(accountKey, cfg.Login.FreeAttempts, cfg.Login.AccountLockout); err == nil {
+				if wait := attemptWait(attempt); wait > 0 {
+					setRetryAfter(c, wait)
+				}
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+			return false
+		}
+		return true
+
+	default:
+		// Sessions rotated from the same sign-in share a family; its first session records when the user signed in
+		var first models.Session
+		err := database.DB.
+			Where("user_id = ? AND family_id = (?)", user.ID,
+				database.DB.Model(&models.Session{}).Select("family_id").Where("id = ?", c.GetUint("sessionID"))).
+			Order("created_at").First(&first).Error
+		if err != nil || time.Since(first.CreatedAt) > stepUpMaxAge {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Sign in again to " + purpose})
+			return false
+		}
+		return true
+	}
+}
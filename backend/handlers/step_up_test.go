@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"mis-system/database"
+	"mis-system/models"
+	"mis-system/totp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enableTestTOTP gives the user a confirmed authenticator app and returns its secret
+func enableTestTOTP(t *testing.T, user *models.User) []byte {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := totpSecretBox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.TOTPFactor{UserID: user.ID, Secret: sealed, ConfirmedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return secret
+}
+
+func TestCheckStepUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string                            // Local password of the account; empty for federated accounts
+		totp       bool                              // The account has an authenticator app
+		amr        []string                          // Methods of the session adding the passkey
+		signedIn   time.Duration                     // How long ago the session's family signed in
+		request    func(secret []byte) StepUpRequest // Step-up fields sent with the change
+		wantStatus int                               // Zero when the change may go ahead
+	}{
+		{
+			name:     "two-factor session",
+			password: "old password 1",
+			totp:     true,
+			amr:      []string{amrPassword, amrOTP, amrMFA},
+			request:  func([]byte) StepUpRequest { return StepUpRequest{} },
+		},
+		{
+			name:       "password account without the password",
+			password:   "old password 1",
+			amr:        []string{amrPassword},
+			request:    func([]byte) StepUpRequest { return StepUpRequest{} },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "password account with a wrong password",
+			password:   "old password 1",
+			amr:        []string{amrPassword},
+			request:    func([]byte) StepUpRequest { return StepUpRequest{CurrentPassword: "wrong password"} },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "password account with its password",
+			password: "old password 1",
+			amr:      []string{amrPassword},
+			request:  func([]byte) StepUpRequest { return StepUpRequest{CurrentPassword: "old password 1"} },
+		},
+		{
+			name:       "authenticator app account with only the password",
+			password:   "old password 1",
+			totp:       true,
+			amr:        []string{amrPassword},
+			request:    func([]byte) StepUpRequest { return StepUpRequest{CurrentPassword: "old password 1"} },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "authenticator app account with a code",
+			password: "old password 1",
+			totp:     true,
+			amr:      []string{amrPassword},
+			request: func(secret []byte) StepUpRequest {
+				return StepUpRequest{MFACodeRequest: MFACodeRequest{Code: totp.Code(secret, time.Now())}}
+			},
+		},
+		{
+			name:     "authenticator app account with a wrong code",
+			password: "old password 1",
+			totp:     true,
+			amr:      []string{amrPassword},
+			request: func([]byte) StepUpRequest {
+				return StepUpRequest{MFACodeRequest: MFACodeRequest{Code: "000000x"}}
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:    "federated account signed in recently",
+			amr:     []string{amrFederated},
+			request: func([]byte) StepUpRequest { return StepUpRequest{} },
+		},
+		{
+			name:       "federated account signed in long ago",
+			amr:        []string{amrFederated},
+			signedIn:   time.Hour,
+			request:    func([]byte) StepUpRequest { return StepUpRequest{} },
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "passkey@example.com", tt.password)
+			var secret []byte
+			if tt.totp {
+				secret = enableTestTOTP(t, user)
+			}
+
+			tokens := signIn(t, user)
+			var session models.Session
+			if err := database.DB.Where("refresh_token = ?", hashToken(tokens.RefreshToken)).First(&session).Error; err != nil {
+				t.Fatal(err)
+			}
+			database.DB.Model(&session).UpdateColumn("created_at", time.Now().Add(-tt.signedIn))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			c.Set("claims", &Claims{UserID: user.ID, SessionID: session.ID, AMR: tt.amr})
+			c.Set("userID", user.ID)
+			c.Set("sessionID", session.ID)
+
+			req := tt.request(secret)
+			ok := checkStepUp(c, user, &req, models.ActionUserUpdate, "change your email address")
+			if tt.wantStatus == 0 {
+				if !ok {
+					t.Fatalf("step-up refused with %d: %s", w.Code, w.Body)
+				}
+				return
+			}
+			if ok || w.Code != tt.wantStatus {
+				t.Errorf("accepted = %v, status = %d, want %d: %s", ok, w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"mis-system/database"
+	"mis-system/models"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tokenDenylist keeps revoked access token IDs in memory in front of the revoked_tokens table.
+// Only revocations read back from the database are cached, so a revocation whose transaction rolls back is never
+// remembered; misses always fall through to the database so other instances' revocations are seen.
+type tokenDenylist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+// denylist is the process-wide access token denylist
+var denylist = &tokenDenylist{entries: make(map[string]time.Time)}
+
+// Revoke persists a revoked token ID until the token expires. It takes effect once tx commits.
+func (d *tokenDenylist) Revoke(tx *gorm.DB, jti string, userID uint, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	// Rows for tokens that have expired anyway are no longer needed
+	return tx.Where("expires_at <= ?", time.Now()).Delete(&models.RevokedToken{}).Error
+}
+
+// Consume revokes a single-use token ID, reporting false when it had already been used
+func (d *tokenDenylist) Consume(tx *gorm.DB, jti string, expiresAt time.Time) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// IsRevoked reports whether a token ID has been revoked
+func (d *tokenDenylist) IsRevoked(jti string) (bool, error) {
+	now := time.Now()
+
+	d.mu.RLock()
+	expiresAt, ok := d.entries[jti]
+	d.mu.RUnlock()
+	if ok && expiresAt.After(now) {
+		return true, nil
+	}
+
+	var revoked models.RevokedToken
+	result := database.DB.Where("jti = ? AND expires_at > ?", jti, now).Limit(1).Find(&revoked)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	d.remember(jti, revoked.ExpiresAt)
+	return true, nil
+}
+
+// remember caches a revoked token ID, dropping cached entries that have expired
+func (d *tokenDenylist) remember(jti string, expiresAt time.Time) {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, exp := range d.entries {
+		if !exp.After(now) {
+			delete(d.entries, id)
+		}
+	}
+	d.entries[jti] = expiresAt
+}
+
+// newTokenID returns a unique identifier for the jti claim
+func newTokenID() string {
+	return uuid.New().String()
+}
+
+// revokeSessions revokes the active sessions matched by the given conditions and denylists every access token
+// still valid in their families, so the revocation takes effect immediately. Tokens issued before the last refresh
+// belong to rotated sessions of the same family and are denylisted too.
+func revokeSessions(tx *gorm.DB, query interface{}, args ...interface{}) (int64, error) {
+	var sessions []models.Session
+	if err := tx.Where(query, args...).Where("revoked_at IS NULL").Find(&sessions).Error; err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uint, len(sessions))
+	var families []string
+	for i, session := range sessions {
+		ids[i] = session.ID
+		if session.FamilyID != "" {
+			families = append(families, session.FamilyID)
+		}
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	// Each session's access token is issued when the session is created and never outlives the configured TTL
+	var issued []models.Session
+	if err := tx.Select("access_token_id", "user_id").
+		Where("(id IN ? OR family_id IN ?) AND access_token_id IS NOT NULL AND created_at > ?",
+			ids, families, now.Add(-cfg.JWT.AccessTokenTTL)).
+		Find(&issued).Error; err != nil {
+		return 0, err
+	}
+	expiresAt := now.Add(cfg.JWT.AccessTokenTTL)
+	for _, session := range issued {
+		if err := denylist.Revoke(tx, session.AccessTokenID, session.UserID, expiresAt); err != nil {
+			return 0, err
+		}
+	}
+
+	return result.RowsAffected, nil
+}
+
+// invalidateUserTokens rejects every access token issued to a user up to now
+func invalidateUserTokens(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.User{}).Unscoped().
+		Where("id = ?", userID).
+		Update("tokens_valid_after", time.Now()).Error
+}
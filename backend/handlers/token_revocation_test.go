@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestDenylistRevoke(t *testing.T) {
+	tests := []struct {
+		name        string
+		rollback    bool // The transaction revoking the token fails
+		wantRevoked bool
+	}{
+		{name: "committed revocation", wantRevoked: true},
+		{name: "rolled back revocation", rollback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			jti := newTokenID()
+
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				if err := denylist.Revoke(tx, jti, 1, time.Now().Add(time.Minute)); err != nil {
+					return err
+				}
+				// A revocation checked inside its own transaction must not reach the shared cache
+				if revoked, err := denylist.IsRevoked(jti); err != nil || revoked {
+					t.Errorf("IsRevoked() before commit = %v, %v", revoked, err)
+				}
+				if tt.rollback {
+					return errors.New("rollback")
+				}
+				return nil
+			})
+			if (err != nil) != tt.rollback {
+				t.Fatalf("transaction error = %v", err)
+			}
+
+			revoked, err := denylist.IsRevoked(jti)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != tt.wantRevoked {
+				t.Errorf("IsRevoked() = %v, want %v", revoked, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestRevokeSessionsRevokesRefreshedTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(t *testing.T, refreshed *TokenResponse, other *TokenResponse) int // Returns the response status
+	}{
+		{
+			name: "session revoked by its owner",
+			revoke: func(t *testing.T, refreshed *TokenResponse, other *TokenResponse) int {
+				var session models.Session
+				database.DB.Where("refresh_token = ?", hashToken(refreshed.RefreshToken)).First(&session)
+				return performJSON(RevokeMySession, http.MethodDelete, nil, func(c *gin.Context) {
+					c.Set("userID", session.UserID)
+					c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(session.ID)}}
+				}).Code
+			},
+		},
+		{
+			name: "other sessions revoked from another device",
+			revoke: func(t *testing.T, refreshed *TokenResponse, other *TokenResponse) int {
+				claims, err := parseClaims(other.AccessToken)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return performJSON(RevokeMyOtherSessions, http.MethodPost, nil, func(c *gin.Context) {
+					c.Set("userID", claims.UserID)
+					c.Set("sessionID", claims.SessionID)
+				}).Code
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "revoke@example.com", "old password 1")
+			tokens := signIn(t, user)
+			other := signIn(t, user) // A second login on another device, in its own family
+
+			w := performJSON(RefreshToken, http.MethodPost, RefreshTokenRequest{tokens.RefreshToken}, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("refresh status = %d: %s", w.Code, w.Body)
+			}
+			var refreshed TokenResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &refreshed); err != nil {
+				t.Fatal(err)
+			}
+
+			if status := tt.revoke(t, &refreshed, other); status != http.StatusOK {
+				t.Fatalf("revoke status = %d", status)
+			}
+
+			// The access token issued before the refresh is still within its lifetime but belongs to the revoked family
+			if status := authenticate(tokens.AccessToken); status != http.StatusUnauthorized {
+				t.Errorf("access token issued before the refresh: status = %d, want 401", status)
+			}
+			if status := authenticate(refreshed.AccessToken); status != http.StatusUnauthorized {
+				t.Errorf("refreshed access token: status = %d, want 401", status)
+			}
+			if status := authenticate(other.AccessToken); status != http.StatusOK {
+				t.Errorf("other device access token: status = %d, want 200", status)
+			}
+		})
+	}
+}
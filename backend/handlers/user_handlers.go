@@ -1,20 +1,31 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"mis-system/database"
 	"mis-system/models"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // RegisterRequest defines the structure for user registration
 type RegisterRequest struct {
 	Email           string `json:"email" binding:"required,email"`
-	Password        string `json:"password" binding:"required,min=6"`
+	Password        string `json:"password" binding:"required"`
 	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=Password"`
-	GoogleSub       string `json:"google_sub"`
+	LinkTicket      string `json:"link_ticket"` // Issued by /auth/google/verify to link the verified Google account
 	FirstName       string `json:"first_name" binding:"required"`
 	LastName        string `json:"last_name" binding:"required"`
 }
@@ -27,48 +38,77 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// A link ticket proves the caller verified an external account with this email
+	var ticket *LinkTicketClaims
+	if input.LinkTicket != "" {
+		claims, err := parseLinkTicket(input.LinkTicket, input.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link ticket"})
+			return
+		}
+		ticket = claims
+	}
+
+	if !checkNewPassword(c, nil, input.Password) {
+		return
+	}
+
+	// Emails of recently deleted accounts stay reserved
+	if err := releaseDeletedEmail(input.Email); err != nil {
+		respondEmailUnavailable(c, err)
+		return
+	}
+
+	// Hash password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+		return
+	}
+
 	// Check if email already exists
 	var existingUser models.User
 	if result := database.DB.Where("email = ?", input.Email).First(&existingUser); result.Error == nil {
-		// If we have a GoogleSub from the request, check if it matches the existing user
-		if input.GoogleSub != "" && existingUser.GoogleSub == input.GoogleSub {
-			// User already exists with the same Google account, just update the password
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
-				return
-			}
-
-			existingUser.Password = string(hashedPassword)
-			existingUser.HasLocalPassword = true
-			if err := database.DB.Save(&existingUser).Error; err != nil {
+		// An account without a password may add one when the ticket is for an identity linked to it
+		var linked int64
+		if ticket != nil && !existingUser.HasLocalPassword {
+			if err := database.DB.Model(&models.UserIdentity{}).
+				Where("user_id = ? AND provider = ? AND subject = ?", existingUser.ID, ticket.Provider, ticket.Subject).
+				Count(&linked).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 				return
 			}
+		}
+		if linked == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+		if !existingUser.IsActive {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			return
+		}
 
-			// Create audit log
-			createAuthAudit(c, existingUser.ID, models.ActionPasswordReset, true, "Password set for Google account")
-
-			// Generate tokens
-			tokenResponse, err := generateTokens(c, &existingUser)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
-				return
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := consumeLinkTicket(tx, ticket); err != nil {
+				return err
 			}
 
-			c.JSON(http.StatusOK, tokenResponse)
+			return setPassword(tx, &existingUser, string(hashedPassword))
+		})
+		if errors.Is(err, errLinkTicketUsed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link ticket"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 			return
 		}
 
-		// Otherwise email already exists with a different account
-		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
-		return
-	}
+		// Create audit log
+		createAuthAudit(c, existingUser.ID, models.ActionPasswordReset, true, "Password set for "+providerDisplayName(ticket.Provider)+" account")
 
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+		// Return tokens, or a challenge when a second factor is needed
+		completeSignIn(c, &existingUser, amrPassword, http.StatusOK)
 		return
 	}
 
@@ -76,16 +116,41 @@ func RegisterUser(c *gin.Context) {
 	user := models.User{
 		Email:            input.Email,
 		Password:         string(hashedPassword),
-		GoogleSub:        input.GoogleSub, // May be empty if registering without Google
 		FirstName:        input.FirstName,
 		LastName:         input.LastName,
 		HasLocalPassword: true,
+		PasswordSetAt:    time.Now(),
 		IsActive:         true,
 		Roles:            models.Roles{models.RoleUser}, // Default role
 	}
 
-	// Save user to database
-	if result := database.DB.Create(&user); result.Error != nil {
+	// Save user to database, linking the external account and using up the link ticket
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := recordPasswordHistory(tx, user.ID, user.Password); err != nil {
+			return err
+		}
+		if ticket == nil {
+			return nil
+		}
+
+		if err := consumeLinkTicket(tx, ticket); err != nil {
+			return err
+		}
+		_, err := linkIdentity(tx, &user, ticket.Profile())
+		return err
+	})
+	if errors.Is(err, errLinkTicketUsed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link ticket"})
+		return
+	}
+	if errors.Is(err, errIdentityTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This external account is already linked to another user"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -93,23 +158,283 @@ func RegisterUser(c *gin.Context) {
 	// Create audit log
 	createAuthAudit(c, user.ID, models.ActionRegister, true, "New user registered")
 
-	// Generate tokens
-	tokenResponse, err := generateTokens(c, &user)
+	// Emails vouched for by a linked provider are already verified
+	if !emailVerified(&user) {
+		sendEmailVerification(c, &user)
+
+		if emailVerificationBlocks(&user) {
+			c.JSON(http.StatusCreated, gin.H{
+				"message":                     "Account created. Check your email to verify your address before signing in",
+				"email_verification_required": true,
+			})
+			return
+		}
+	}
+
+	// Return tokens, or a challenge when the default role requires a second factor
+	completeSignIn(c, &user, amrPassword, http.StatusCreated)
+}
+
+// CreateUserRequest defines the structure for admin user creation
+type CreateUserRequest struct {
+	Email      string       `json:"email" binding:"required,email"`
+	FirstName  string       `json:"first_name" binding:"required"`
+	LastName   string       `json:"last_name" binding:"required"`
+	Password   string       `json:"password"`
+	Roles      models.Roles `json:"roles"`
+	IsActive   *bool        `json:"is_active"`
+	IsAdmin    bool         `json:"is_admin"`
+	SendInvite bool         `json:"send_invite"` // Email an invitation link instead of setting a password
+}
+
+// CreateUser handles user creation by an administrator.
+// Unlike RegisterUser it does not log anyone in, and it can set roles and account flags.
+func CreateUser(c *gin.Context) {
+	var input CreateUserRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Exactly one way of setting the initial password is required
+	if input.SendInvite == (input.Password != "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either a password or send_invite, but not both"})
+		return
+	}
+
+	// Default role and flags
+	roles := uniqueRoles(input.Roles)
+	if len(roles) == 0 {
+		roles = models.Roles{models.RoleUser}
+	}
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+
+	// Only administrators may create other administrators
+	if (input.IsAdmin || hasAnyRole(roles, []models.Role{models.RoleAdmin})) && !isAdmin(c) {
+		abortForbidden(c)
+		return
+	}
+
+	if err := validateRoles(roles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Nor may anyone hand out permissions they do not hold themselves
+	claims, _ := currentClaims(c)
+	allowed, err := canGrantRoles(claims, roles)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if !allowed {
+		abortForbidden(c)
+		return
+	}
+
+	if input.Password != "" && !checkNewPassword(c, nil, input.Password) {
 		return
 	}
 
-	// Return tokens and user info
-	c.JSON(http.StatusCreated, tokenResponse)
+	// Emails of recently deleted accounts stay reserved
+	if err := releaseDeletedEmail(input.Email); err != nil {
+		respondEmailUnavailable(c, err)
+		return
+	}
+
+	// Check if email already exists
+	var existingUser models.User
+	if result := database.DB.Where("email = ?", input.Email).First(&existingUser); result.Error == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	user := models.User{
+		Email:     input.Email,
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Roles:     roles,
+		IsActive:  isActive,
+		IsAdmin:   input.IsAdmin,
+	}
+
+	// Hash password when one was provided
+	if input.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password hashing failed"})
+			return
+		}
+		user.Password = string(hashedPassword)
+		user.HasLocalPassword = true
+		user.PasswordSetAt = time.Now()
+	}
+
+	// Save user to database, starting the password history
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if !user.HasLocalPassword {
+			return nil
+		}
+		return recordPasswordHistory(tx, user.ID, user.Password)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	// Send an invitation link the user can use to choose their password
+	if input.SendInvite {
+		token, err := issuePasswordResetToken(user.ID, cfg.Auth.InviteTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User created but the invitation could not be issued"})
+			return
+		}
+
+		sendMail(user.Email, "invitation", gin.H{
+			"FirstName": user.FirstName,
+			"ActionURL": appURL("/reset-password", url.Values{"token": {token}, "email": {user.Email}, "invite": {"true"}}),
+			"ExpiresIn": formatDuration(cfg.Auth.InviteTTL),
+		})
+	} else {
+		// Invitations verify the email when accepted; accounts given a password are asked to confirm it
+		sendEmailVerification(c, &user)
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionUserCreate, true, fmt.Sprintf("User created by user %d", c.GetUint("userID")))
+
+	c.JSON(http.StatusCreated, gin.H{"data": user})
+}
+
+// userSortColumns maps the sort keys accepted by GetAllUsers to columns
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"email":      "email",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"created_at": "created_at",
+	"last_login": "last_login",
 }
 
-// GetAllUsers retrieves all users
+// GetAllUsers retrieves a page of users matching the query filters.
+// Supported parameters: page, per_page, sort, q, role, is_active, has_local_password, google_linked, email_verified,
+// created_after, created_before, last_login_after, last_login_before and deleted.
 func GetAllUsers(c *gin.Context) {
+	page, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sort, err := parseSort(c, userSortColumns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := userFilterScope(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deleted, err := parseBoolQuery(c, "deleted")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// List soft-deleted users instead when deleted=true
+	base := database.DB.Model(&models.User{})
+	if deleted != nil && *deleted {
+		base = database.DB.Unscoped().Model(&models.User{}).Where("deleted_at IS NOT NULL")
+	}
+
+	// Share the filters between the count and the page query
+	query := base.
+		Scopes(filter, database.Search(c.Query("q"), "email", "first_name", "last_name")).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count users"})
+		return
+	}
+
 	var users []models.User
-	database.DB.Find(&users)
+	if err := query.Scopes(database.OrderBy(sort), database.Paginate(page)).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load users"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"data": users})
+	meta := setPaginationHeaders(c, page, total)
+	c.JSON(http.StatusOK, gin.H{"data": users, "meta": meta})
+}
+
+// userFilterScope builds the filter scope for GetAllUsers from the query string
+func userFilterScope(c *gin.Context) (func(db *gorm.DB) *gorm.DB, error) {
+	isActive, err := parseBoolQuery(c, "is_active")
+	if err != nil {
+		return nil, err
+	}
+	hasLocalPassword, err := parseBoolQuery(c, "has_local_password")
+	if err != nil {
+		return nil, err
+	}
+	googleLinked, err := parseBoolQuery(c, "google_linked")
+	if err != nil {
+		return nil, err
+	}
+	verified, err := parseBoolQuery(c, "email_verified")
+	if err != nil {
+		return nil, err
+	}
+
+	var times [4]*time.Time
+	for i, name := range []string{"created_after", "created_before", "last_login_after", "last_login_before"} {
+		if times[i], err = parseTimeQuery(c, name); err != nil {
+			return nil, err
+		}
+	}
+
+	role := c.Query("role")
+
+	return func(db *gorm.DB) *gorm.DB {
+		if role != "" {
+			db = db.Where("EXISTS (SELECT 1 FROM json_each(users.roles) WHERE json_each.value = ?)", role)
+		}
+		if isActive != nil {
+			db = db.Where("is_active = ?", *isActive)
+		}
+		if hasLocalPassword != nil {
+			db = db.Where("has_local_password = ?", *hasLocalPassword)
+		}
+		if googleLinked != nil {
+			linked := "EXISTS (SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id AND user_identities.provider = ?)"
+			if *googleLinked {
+				db = db.Where(linked, models.ProviderGoogle)
+			} else {
+				db = db.Where("NOT "+linked, models.ProviderGoogle)
+			}
+		}
+		if verified != nil {
+			if *verified {
+				db = db.Where("email_verified_at IS NOT NULL")
+			} else {
+				db = db.Where("email_verified_at IS NULL")
+			}
+		}
+
+		return db.Scopes(
+			database.TimeRange("created_at", times[0], times[1]),
+			database.TimeRange("last_login", times[2], times[3]),
+		)
+	}, nil
 }
 
 // GetUserByID retrieves a single user by ID
@@ -123,24 +448,226 @@ func GetUserByID(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": user})
 }
 
-// UpdateUser updates a user's information
+// UpdateUserRequest defines the structure for a partial user update.
+// Fields left out of the request body are not changed.
+type UpdateUserRequest struct {
+	FirstName     *string       `json:"first_name" binding:"omitempty,max=100"`
+	LastName      *string       `json:"last_name" binding:"omitempty,max=100"`
+	Email         *string       `json:"email" binding:"omitempty,email"`
+	Roles         *models.Roles `json:"roles"`
+	IsActive      *bool         `json:"is_active"`
+	IsAdmin       *bool         `json:"is_admin"`
+	StepUpRequest               // Required to change your own email address
+}
+
+// UpdateUser applies a JSON Merge Patch (RFC 7396) to a user.
+// Users may edit their own profile; editing others requires users:update, and only admins may change roles, flags and
+// other users' email addresses.
 func UpdateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	input, err := bindUpdateUserRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Authorize before loading the user so the response does not reveal which IDs exist.
+	// Users may always edit themselves; anyone else needs the update permission.
+	claims, _ := currentClaims(c)
+	self := claims != nil && uint64(claims.UserID) == id
+	if !self {
+		allowed, err := hasPermission(claims, models.PermUsersUpdate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			abortForbidden(c)
+			return
+		}
+	}
+
+	// Roles and account flags are reserved for administrators
+	if (input.Roles != nil || input.IsActive != nil || input.IsAdmin != nil) && !isAdmin(c) {
+		abortForbidden(c)
+		return
+	}
+
 	var user models.User
-	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+	if err := database.DB.First(&user, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	var input RegisterRequest
-	if err := c.ShouldBindJSON(&input); err != nil {
+	changes, descriptions, err := userChanges(&user, input)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	database.DB.Model(&user).Updates(models.User{
-		FirstName: input.FirstName,
-		LastName:  input.LastName,
+	// A new email address can receive password resets, so changing it takes over the account. Only administrators may
+	// change other users' addresses, and users changing their own must prove they are the account holder.
+	if _, ok := changes["email"]; ok {
+		if !self && !isAdmin(c) {
+			abortForbidden(c)
+			return
+		}
+		if self && !checkStepUp(c, &user, &input.StepUpRequest, models.ActionUserUpdate, "change your email address") {
+			return
+		}
+	}
+
+	// Prevent administrators from locking themselves out
+	if self && (changes["is_active"] == false || changes["is_admin"] == false ||
+		(input.Roles != nil && hasAnyRole(user.Roles, []models.Role{models.RoleAdmin}) &&
+			!hasAnyRole(*input.Roles, []models.Role{models.RoleAdmin}))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own administrator access or deactivate yourself"})
+		return
+	}
+
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{"data": user})
+		return
+	}
+
+	// Email addresses must stay unique, and a new one must be verified again
+	if email, ok := changes["email"]; ok {
+		changes["email_verified_at"] = nil
+
+		if err := releaseDeletedEmail(email.(string)); err != nil {
+			respondEmailUnavailable(c, err)
+			return
+		}
+
+		var existingUser models.User
+		if result := database.DB.Where("email = ? AND id <> ?", email, user.ID).First(&existingUser); result.Error == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(changes).Error; err != nil {
+			return err
+		}
+
+		// Deactivated accounts lose every active session
+		if changes["is_active"] == false {
+			return revokeUserSessions(tx, user.ID)
+		}
+
+		// Access tokens carry the roles and admin flag, so outstanding ones must not outlive a change to them
+		_, rolesChanged := changes["roles"]
+		_, adminChanged := changes["is_admin"]
+		if rolesChanged || adminChanged {
+			return invalidateUserTokens(tx, user.ID)
+		}
+
+		return nil
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionUserUpdate, true,
+		fmt.Sprintf("Updated by user %d: %s", c.GetUint("userID"), strings.Join(descriptions, "; ")))
+
+	database.DB.First(&user, user.ID)
+
+	if _, ok := changes["email"]; ok {
+		sendEmailVerification(c, &user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// bindUpdateUserRequest decodes a merge patch body.
+// A null member removes the value, which is only allowed for optional fields.
+func bindUpdateUserRequest(c *gin.Context) (*UpdateUserRequest, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+
+	var input UpdateUserRequest
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+
+	for name, value := range members {
+		if string(value) != "null" {
+			continue
+		}
+
+		empty := ""
+		switch name {
+		case "first_name":
+			input.FirstName = &empty
+		case "last_name":
+			input.LastName = &empty
+		case "roles":
+			input.Roles = &models.Roles{}
+		case "email", "is_active", "is_admin":
+			return nil, fmt.Errorf("%s cannot be removed", name)
+		}
+	}
+
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return nil, err
+	}
+
+	return &input, nil
+}
+
+// userChanges compares a patch with the stored user and returns the column updates and a description of each change
+func userChanges(user *models.User, input *UpdateUserRequest) (map[string]interface{}, []string, error) {
+	changes := make(map[string]interface{})
+	var descriptions []string
+
+	if input.FirstName != nil && *input.FirstName != user.FirstName {
+		changes["first_name"] = *input.FirstName
+		descriptions = append(descriptions, fmt.Sprintf("first_name %q -> %q", user.FirstName, *input.FirstName))
+	}
+	if input.LastName != nil && *input.LastName != user.LastName {
+		changes["last_name"] = *input.LastName
+		descriptions = append(descriptions, fmt.Sprintf("last_name %q -> %q", user.LastName, *input.LastName))
+	}
+	if input.Email != nil && !strings.EqualFold(*input.Email, user.Email) {
+		changes["email"] = *input.Email
+		descriptions = append(descriptions, fmt.Sprintf("email %q -> %q", user.Email, *input.Email))
+	}
+	if input.Roles != nil {
+		roles := uniqueRoles(*input.Roles)
+		if err := validateRoles(roles); err != nil {
+			return nil, nil, err
+		}
+		if fmt.Sprint(roles) != fmt.Sprint(user.Roles) {
+			changes["roles"] = roles
+			descriptions = append(descriptions, fmt.Sprintf("roles %v -> %v", user.Roles, roles))
+		}
+	}
+	if input.IsActive != nil && *input.IsActive != user.IsActive {
+		changes["is_active"] = *input.IsActive
+		descriptions = append(descriptions, fmt.Sprintf("is_active %t -> %t", user.IsActive, *input.IsActive))
+	}
+	if input.IsAdmin != nil && *input.IsAdmin != user.IsAdmin {
+		changes["is_admin"] = *input.IsAdmin
+		descriptions = append(descriptions, fmt.Sprintf("is_admin %t -> %t", user.IsAdmin, *input.IsAdmin))
+	}
+
+	return changes, descriptions, nil
 }
 
 // GetCurrentUser returns the currently authenticated user
@@ -152,11 +679,16 @@ func GetCurrentUser(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := database.DB.First(&user, userID).Error; err != nil {
+	if err := database.DB.Preload("Identities").First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
+	linked := make([]string, 0, len(user.Identities))
+	for _, identity := range user.Identities {
+		linked = append(linked, identity.Provider)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
 			"id":               user.ID,
@@ -165,42 +697,10 @@ func GetCurrentUser(c *gin.Context) {
 			"lastName":         user.LastName,
 			"roles":            user.Roles,
 			"isAdmin":          user.IsAdmin,
-			"googleSub":        user.GoogleSub != "",
+			"googleSub":        slices.Contains(linked, models.ProviderGoogle),
+			"identities":       linked,
 			"hasLocalPassword": user.HasLocalPassword,
+			"emailVerified":    emailVerified(&user),
 		},
 	})
-
-	c.JSON(http.StatusOK, gin.H{"data": user})
-}
-
-// DeleteUser removes a user
-func DeleteUser(c *gin.Context) {
-	var user models.User
-	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	database.DB.Delete(&user)
-
-	c.JSON(http.StatusOK, gin.H{"data": true})
-}
-
-// ResetPasswordRequest defines the structure for password reset
-type ResetPasswordRequest struct {
-	Token       string `json:"token" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
-}
-
-// ResetPassword handles password reset with token
-func ResetPassword(c *gin.Context) {
-	var input ResetPasswordRequest
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// In a real app, validate the reset token against stored tokens
-	// For this example, we'll just return an error since we're not implementing the full flow
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
 }
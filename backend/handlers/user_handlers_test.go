@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// asUser authenticates a test request as the given claims and targets the user with the given ID
+func asUser(claims *Claims, targetID string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Params = gin.Params{{Key: "id", Value: targetID}}
+		c.Set("claims", claims)
+		c.Set("userID", claims.UserID)
+	}
+}
+
+func TestUpdateUserAuthorization(t *testing.T) {
+	setupTestDB(t)
+	member := createTestUser(t, "member@example.com", "")
+	other := createTestUser(t, "other@example.com", "")
+
+	memberClaims := &Claims{UserID: member.ID, Roles: models.Roles{models.RoleUser}}
+	adminClaims := &Claims{UserID: 9999, Admin: true}
+
+	tests := []struct {
+		name       string
+		claims     *Claims
+		target     string
+		wantStatus int
+	}{
+		{"member edits themselves", memberClaims, fmt.Sprint(member.ID), http.StatusOK},
+		{"member edits another user", memberClaims, fmt.Sprint(other.ID), http.StatusForbidden},
+		{"member edits a missing user", memberClaims, "424242", http.StatusForbidden},
+		{"admin edits a missing user", adminClaims, "424242", http.StatusNotFound},
+		{"admin edits another user", adminClaims, fmt.Sprint(other.ID), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performJSON(UpdateUser, http.MethodPatch, gin.H{"first_name": "Changed"}, asUser(tt.claims, tt.target))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestUpdateUserInvalidatesTokens(t *testing.T) {
+	adminClaims := &Claims{UserID: 9999, Admin: true}
+
+	tests := []struct {
+		name           string
+		patch          gin.H
+		wantInvalidate bool
+	}{
+		{"name change", gin.H{"first_name": "Renamed"}, false},
+		{"roles change", gin.H{"roles": []string{"inspector"}}, true},
+		{"admin flag removed", gin.H{"is_admin": false}, true},
+		{"deactivation", gin.H{"is_active": false}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "demoted@example.com", "")
+			database.DB.Model(user).Updates(map[string]interface{}{"is_admin": true, "roles": models.Roles{models.RoleAdmin}})
+
+			w := performJSON(UpdateUser, http.MethodPatch, tt.patch, asUser(adminClaims, fmt.Sprint(user.ID)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var stored models.User
+			database.DB.First(&stored, user.ID)
+			if invalidated := !stored.TokensValidAfter.IsZero(); invalidated != tt.wantInvalidate {
+				t.Errorf("tokens invalidated = %v, want %v", invalidated, tt.wantInvalidate)
+			}
+		})
+	}
+}
+
+func TestGetCurrentUserSingleDocument(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "me@example.com", "old password 1")
+
+	w := performJSON(GetCurrentUser, http.MethodGet, nil, asUser(&Claims{UserID: user.ID}, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	// decodeJSON fails on anything after the first document
+	body := decodeJSON(t, w)
+	if _, ok := body["data"]; ok {
+		t.Errorf("response includes the stored user model: %s", w.Body)
+	}
+	if profile, ok := body["user"].(map[string]interface{}); !ok || profile["email"] != user.Email {
+		t.Errorf("user = %v", body["user"])
+	}
+}
+
+func TestCreateUserRoleEscalation(t *testing.T) {
+	setupTestDB(t)
+	for name, permissions := range map[models.Role][]models.Permission{
+		"recruiter": {models.PermUsersCreate, models.PermUsersRead},
+		"helpdesk":  {models.PermUsersRead},
+		"security":  {models.PermUsersRead, models.PermSessionsManage},
+	} {
+		if err := database.DB.Create(&models.RoleDefinition{Name: name, Permissions: rolePermissions(permissions)}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	creator := &Claims{UserID: 9999, Roles: models.Roles{"recruiter"}}
+
+	tests := []struct {
+		name       string
+		roles      []string
+		wantStatus int
+	}{
+		{"default role", nil, http.StatusCreated},
+		{"role with fewer permissions", []string{"helpdesk"}, http.StatusCreated},
+		{"the creator's own role", []string{"recruiter"}, http.StatusCreated},
+		{"role with a permission the creator lacks", []string{"security"}, http.StatusForbidden},
+		{"mix including such a role", []string{"helpdesk", "security"}, http.StatusForbidden},
+		{"admin role", []string{"admin"}, http.StatusForbidden},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := fmt.Sprintf("created%d@example.com", i)
+			w := performJSON(CreateUser, http.MethodPost, gin.H{
+				"email":      email,
+				"first_name": "New",
+				"last_name":  "User",
+				"password":   "a new horse battery 7",
+				"roles":      tt.roles,
+			}, asUser(creator, ""))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var count int64
+			database.DB.Model(&models.User{}).Where("email = ?", email).Count(&count)
+			if created := count > 0; created != (tt.wantStatus == http.StatusCreated) {
+				t.Errorf("user created = %v", created)
+			}
+		})
+	}
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		self       bool // The user changes their own email; otherwise an editor changes the admin's
+		editorRole bool // The editor holds users:update through a role rather than being an admin
+		patch      gin.H
+		wantStatus int
+	}{
+		{name: "users:update holder changes an admin's email", editorRole: true,
+			patch: gin.H{"email": "attacker@example.com"}, wantStatus: http.StatusForbidden},
+		{name: "users:update holder changes an admin's name", editorRole: true,
+			patch: gin.H{"first_name": "Renamed"}, wantStatus: http.StatusOK},
+		{name: "users:update holder sends the unchanged email", editorRole: true,
+			patch: gin.H{"email": "target@example.com", "first_name": "Renamed"}, wantStatus: http.StatusOK},
+		{name: "admin changes another user's email",
+			patch: gin.H{"email": "moved@example.com"}, wantStatus: http.StatusOK},
+		{name: "own email without the password", self: true,
+			patch: gin.H{"email": "moved@example.com"}, wantStatus: http.StatusForbidden},
+		{name: "own email with a wrong password", self: true,
+			patch: gin.H{"email": "moved@example.com", "current_password": "wrong password"}, wantStatus: http.StatusBadRequest},
+		{name: "own email with the password", self: true,
+			patch: gin.H{"email": "moved@example.com", "current_password": "old password 1"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			target := createTestUser(t, "target@example.com", "old password 1")
+			database.DB.Model(target).Updates(map[string]interface{}{"is_admin": true, "roles": models.Roles{models.RoleAdmin}})
+			if err := database.DB.Create(&models.RoleDefinition{
+				Name:        "editor",
+				Permissions: rolePermissions([]models.Permission{models.PermUsersRead, models.PermUsersUpdate}),
+			}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			claims := &Claims{UserID: 9999, Admin: true}
+			switch {
+			case tt.self:
+				claims = &Claims{UserID: target.ID, Roles: models.Roles{models.RoleAdmin}, Admin: true, AMR: []string{amrPassword}}
+			case tt.editorRole:
+				claims = &Claims{UserID: 9999, Roles: models.Roles{"editor"}}
+			}
+
+			w := performJSON(UpdateUser, http.MethodPatch, tt.patch, asUser(claims, fmt.Sprint(target.ID)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var stored models.User
+			database.DB.First(&stored, target.ID)
+			email, _ := tt.patch["email"].(string)
+			wantChanged := tt.wantStatus == http.StatusOK && email != "" && email != "target@example.com"
+			if changed := stored.Email != "target@example.com"; changed != wantChanged {
+				t.Errorf("email = %q, changed = %v, want %v", stored.Email, changed, wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errEmailReserved is returned while a deleted account's email is inside its grace period
+var errEmailReserved = errors.New("email belongs to a recently deleted account")
+
+// DeleteUser soft-deletes a user and revokes all of their sessions
+func DeleteUser(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.ID == c.GetUint("userID") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionUserDelete, true, fmt.Sprintf("Deleted by user %d", c.GetUint("userID")))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// RestoreUser brings back a soft-deleted user
+func RestoreUser(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted user not found"})
+		return
+	}
+
+	// Once the email went to someone else the account cannot sign in again, and its identities are gone
+	if user.Email == releasedEmail(user.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The user's email was released after the grace period; the account can no longer be restored"})
+		return
+	}
+
+	if err := database.DB.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		return
+	}
+
+	// Create audit log
+	createAuthAudit(c, user.ID, models.ActionUserRestore, true, fmt.Sprintf("Restored by user %d", c.GetUint("userID")))
+
+	database.DB.First(&user, user.ID)
+	c.JSON(http.StatusOK, gin.H{"data": user})
+}
+
+// PurgeUser permanently removes a soft-deleted user and strips personal data from their audit trail.
+// The user must already be deleted and the request must repeat their email in the confirm query parameter.
+func PurgeUser(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted user not found; users must be deleted before they can be purged"})
+		return
+	}
+
+	if !strings.EqualFold(c.Query("confirm"), user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirm the purge by passing the user's email in the confirm parameter"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Keep the audit trail but remove anything that identifies a person
+		if err := tx.Model(&models.AuthAudit{}).Where("user_id = ?", user.ID).Updates(map[string]interface{}{
+			"ip_address": nil,
+			"user_agent": nil,
+			"device_id":  nil,
+			"details":    nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PasswordHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := deleteMFA(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.WebAuthnCredential{}).Error; err != nil {
+			return err
+		}
+
+		// Failure counters are keyed by the email, and denylisted tokens name the user
+		if err := tx.Where("subject IN ?", []string{accountThrottleKey(user.Email), mfaThrottleKey(user.ID)}).
+			Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RevokedToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge user"})
+		return
+	}
+
+	// Record the purge against the acting administrator without repeating the purged user's details
+	createAuthAudit(c, c.GetUint("userID"), models.ActionUserPurge, true, fmt.Sprintf("Purged user %d", user.ID))
+
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// releaseDeletedEmail frees an email and linked accounts held by a soft-deleted user once the grace
+// period has passed, so they can be registered again. Within the grace period it returns errEmailReserved.
+func releaseDeletedEmail(email string) error {
+	var deleted models.User
+	if err := database.DB.Unscoped().
+		Where("email = ? AND deleted_at IS NOT NULL", email).
+		First(&deleted).Error; err != nil {
+		return nil
+	}
+
+	if time.Since(deleted.DeletedAt.Time) < cfg.Users.DeletedEmailGrace {
+		return errEmailReserved
+	}
+
+	// Release the deleted user's external accounts along with the email
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", deleted.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&deleted).
+			Update("email", releasedEmail(deleted.ID)).Error
+	})
+}
+
+// releasedEmail returns the placeholder a deleted user's email is replaced with once it is released
+func releasedEmail(userID uint) string {
+	return fmt.Sprintf("deleted-%d@invalid", userID)
+}
+
+// respondEmailUnavailable writes the response for a failed releaseDeletedEmail
+func respondEmailUnavailable(c *gin.Context, err error) {
+	if errors.Is(err, errEmailReserved) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email availability"})
+}
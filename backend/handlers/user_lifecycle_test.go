@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestRestoreUser(t *testing.T) {
+	adminClaims := &Claims{UserID: 9999, Admin: true}
+
+	tests := []struct {
+		name       string
+		deletedAgo time.Duration // Zero keeps the user active
+		reRegister bool          // Register the email again, releasing it when the grace period is over
+		wantStatus int
+	}{
+		{"user not deleted", 0, false, http.StatusNotFound},
+		{"within the grace period", time.Hour, false, http.StatusOK},
+		{"after the grace period, email still unused", 60 * 24 * time.Hour, false, http.StatusOK},
+		{"after the grace period, email released", 60 * 24 * time.Hour, true, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t)
+			user := createTestUser(t, "restore@example.com", "")
+			if tt.deletedAgo > 0 {
+				database.DB.Delete(user)
+				database.DB.Unscoped().Model(user).Update("deleted_at", time.Now().Add(-tt.deletedAgo))
+			}
+			if tt.reRegister {
+				if err := releaseDeletedEmail(user.Email); err != nil {
+					t.Fatalf("release email: %v", err)
+				}
+				createTestUser(t, user.Email, "")
+			}
+
+			w := performJSON(RestoreUser, http.MethodPost, nil, asUser(adminClaims, fmt.Sprint(user.ID)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var stored models.User
+			restored := database.DB.First(&stored, user.ID).Error == nil
+			if wantRestored := tt.wantStatus != http.StatusConflict; restored != wantRestored {
+				t.Errorf("user active = %v, want %v", restored, wantRestored)
+			}
+		})
+	}
+}
+
+func TestPurgeUserRemovesPersonalData(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "purged@example.com", "old password 1")
+	signIn(t, user)
+	enableTestTOTP(t, user)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	recordLoginFailure(c, user, user.Email, "Invalid password")
+	respondMFAFailed(c, user.ID)
+	if err := database.DB.Create(&models.RevokedToken{JTI: "revoked-jti", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Delete(user)
+
+	admin := asUser(&Claims{UserID: 9999, Admin: true}, fmt.Sprint(user.ID))
+	w := performJSON(PurgeUser, http.MethodDelete, nil, func(c *gin.Context) {
+		admin(c)
+		c.Request.URL.RawQuery = "confirm=" + user.Email
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	remaining := map[string]*gorm.DB{
+		"users":          database.DB.Unscoped().Model(&models.User{}).Where("id = ?", user.ID),
+		"sessions":       database.DB.Model(&models.Session{}).Where("user_id = ?", user.ID),
+		"totp_factors":   database.DB.Model(&models.TOTPFactor{}).Where("user_id = ?", user.ID),
+		"revoked_tokens": database.DB.Model(&models.RevokedToken{}).Where("user_id = ?", user.ID),
+		"login_attempts": database.DB.Model(&models.LoginAttempt{}).Where("subject IN ?", []string{accountThrottleKey(user.Email), mfaThrottleKey(user.ID)}),
+		"audit details":  database.DB.Model(&models.AuthAudit{}).Where("user_id = ? AND (ip_address IS NOT NULL OR details IS NOT NULL)", user.ID),
+	}
+	for table, query := range remaining {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("%s rows left for the purged user: %d", table, count)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"mis-system/config"
+	"mis-system/database"
+	"mis-system/models"
+	"mis-system/webauthn"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Audiences of the tokens carrying a passkey ceremony's challenge between its two requests
+const (
+	passkeyRegistrationAudience = "webauthn-registration"
+	passkeyLoginAudience        = "webauthn-login"
+)
+
+// amrHardwareKey records a sign-in with a passkey (RFC 8176 "hwk")
+const amrHardwareKey = "hwk"
+
+var (
+	errPasskeyCeremonyInvalid = errors.New("invalid or expired passkey ceremony")
+	errPasskeyRegistered      = errors.New("passkey already registered")
+)
+
+// PasskeyCeremonyClaims defines the claims of a ceremony token; the subject is the registering user's ID
+type PasskeyCeremonyClaims struct {
+	Challenge webauthn.Base64URL `json:"challenge"`
+	jwt.RegisteredClaims
+}
+
+// PasskeyLoginOptionsRequest defines the structure for starting a passkey sign-in
+type PasskeyLoginOptionsRequest struct {
+	Email string `json:"email"` // Optional; without it the user picks one of the passkeys stored on their device
+}
+
+// PasskeyLoginRequest defines the structure for completing a passkey sign-in
+type PasskeyLoginRequest struct {
+	Ceremony   string                      `json:"ceremony" binding:"required"`
+	Credential *webauthn.AssertionResponse `json:"credential" binding:"required"`
+}
+
+// newRelyingParty builds the WebAuthn relying party from the configuration
+func newRelyingParty(c *config.Config) *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:      c.WebAuthn.RPID,
+		Name:    c.WebAuthn.RPName,
+		Origins: c.WebAuthnOrigins(),
+		Timeout: c.WebAuthn.Timeout,
+	}
+}
+
+// issuePasskeyCeremony signs a short-lived token holding a fresh challenge for one ceremony
+func issuePasskeyCeremony(audience, subject string) (string, []byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", nil, err
+	}
+
+	claims := &PasskeyCeremonyClaims{
+		Challenge:        challenge,
+		RegisteredClaims: internalClaims(audience, subject, cfg.WebAuthn.Timeout),
+	}
+
+	token, err := signInternalToken(audience, claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, challenge, nil
+}
+
+// parsePasskeyCeremony validates a ceremony token issued for audience and returns its claims
+func parsePasskeyCeremony(token, audience string) (*PasskeyCeremonyClaims, error) {
+	claims := &PasskeyCeremonyClaims{}
+	err := parseInternalToken(token, audience, claims)
+	if err != nil || len(claims.Challenge) == 0 || claims.ID == "" {
+		return nil, errPasskeyCeremonyInvalid
+	}
+
+	return claims, nil
+}
+
+// consumePasskeyCeremony marks a ceremony as finished so its challenge cannot be answered twice
+func consumePasskeyCeremony(tx *gorm.DB, claims *PasskeyCeremonyClaims) error {
+	ok, err := denylist.Consume(tx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errPasskeyCeremonyInvalid
+	}
+
+	return nil
+}
+
+// passkeyUserHandle returns the opaque WebAuthn user handle of a user, derived so it reveals nothing about them
+func passkeyUserHandle(userID uint) []byte {
+	mac := hmac.New(sha256.New, internalKey("webauthn-user-handle"))
+	mac.Write([]byte(strconv.FormatUint(uint64(userID), 10)))
+	return mac.Sum(nil)
+}
+
+// passkeyDescriptors lists credentials for allowCredentials and excludeCredentials
+func passkeyDescriptors(credentials []models.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		id, err := decodeBase64URL(credential.CredentialID)
+		if err != nil {
+			continue
+		}
+
+		descriptor := webauthn.CredentialDescriptor{Type: "public-key", ID: id}
+		if credential.Transports != "" {
+			descriptor.Transports = strings.Split(credential.Transports, ",")
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+
+	return descriptors
+}
+
+// decodeBase64URL decodes a stored credential ID
+func decodeBase64URL(s string) (webauthn.Base64URL, error) {
+	var b webauthn.Base64URL
+	err := b.UnmarshalJSON([]byte(strconv.Quote(s)))
+	return b, err
+}
+
+// GetPasskeyLoginOptions starts a passkey sign-in, returning the options for navigator.credentials.get
+func GetPasskeyLoginOptions(c *gin.Context) {
+	// The body is optional
+	var req PasskeyLoginOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// With an email the user's passkeys are offered explicitly, which security keys without discoverable credentials need
+	var credentials []models.WebAuthnCredential
+	if req.Email != "" {
+		if err := database.DB.Joins("JOIN users ON users.id = web_authn_credentials.user_id").
+			Where("users.email = ? AND users.deleted_at IS NULL", req.Email).
+			Find(&credentials).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+			return
+		}
+	}
+
+	allow := passkeyDescriptors(credentials)
+	if req.Email != "" && len(allow) == 0 {
+		// An empty list would tell that the email has no account, or no passkeys
+		allow = decoyPasskeyDescriptors(req.Email)
+	}
+
+	ceremony, challenge, err := issuePasskeyCeremony(passkeyLoginAudience, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey sign-in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"ceremony":  ceremony,
+		"publicKey": relyingParty.RequestOptions(challenge, allow),
+	}})
+}
+
+// decoyTransports are the transports decoy passkeys claim, picked as real credentials commonly report them
+var decoyTransports = [][]string{{"internal", "hybrid"}, {"usb"}, {"usb", "nfc"}, {"hybrid", "internal"}}
+
+// decoyPasskeyDescriptors returns a made-up credential for an email without passkeys.
+// It is derived from the email, so asking twice returns the same list, as it would for a real account.
+func decoyPasskeyDescriptors(email string) []webauthn.CredentialDescriptor {
+	mac := hmac.New(sha256.New, internalKey("passkey-decoys"))
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	id := mac.Sum(nil)
+
+	return []webauthn.CredentialDescriptor{{
+		Type:       "public-key",
+		ID:         id,
+		Transports: decoyTransports[int(id[0])%len(decoyTransports)],
+	}}
+}
+
+// PasskeyLogin signs a user in with a passkey assertion.
+// Passkeys that verified the user with a PIN or biometric count as two factors; others may still need a second factor.
+func PasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := parsePasskeyCeremony(req.Ceremony, passkeyLoginAudience)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+
+	var credential models.WebAuthnCredential
+	if err := database.DB.Where("credential_id = ?", req.Credential.RawID.String()).First(&credential).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown passkey"})
+		return
+	}
+
+	// Discoverable credentials name their user, which must be the credential's owner
+	handle := req.Credential.Response.UserHandle
+	if len(handle) > 0 && !hmac.Equal(handle, passkeyUserHandle(credential.UserID)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown passkey"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, credential.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown passkey"})
+		return
+	}
+	if !user.IsActive {
+		createAuthAudit(c, user.ID, models.ActionLogin, false, "Account is disabled")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if emailVerificationBlocks(&user) {
+		respondEmailUnverified(c, &user, models.ActionLogin)
+		return
+	}
+
+	key, err := webauthn.ParsePublicKey(credential.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkey"})
+		return
+	}
+
+	assertion, err := relyingParty.VerifyAssertion(req.Credential, claims.Challenge, key, credential.SignCount)
+	if errors.Is(err, webauthn.ErrSignCount) {
+		createAuthAudit(c, user.ID, models.ActionLogin, false,
+			"Passkey "+credential.Name+" signature counter went backwards; the authenticator may have been cloned")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+	if err != nil {
+		createAuthAudit(c, user.ID, models.ActionLogin, false, "Passkey verification failed: "+err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := consumePasskeyCeremony(tx, claims); err != nil {
+			return err
+		}
+
+		// A concurrent sign-in with the same counter value means one of them was replayed
+		result := tx.Model(&credential).Where("sign_count = ?", credential.SignCount).Updates(map[string]interface{}{
+			"sign_count":   assertion.SignCount,
+			"backed_up":    assertion.BackedUp,
+			"last_used_at": time.Now(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPasskeyCeremonyInvalid
+		}
+		return nil
+	})
+	if errors.Is(err, errPasskeyCeremonyInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired passkey challenge"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+
+	// Update last login time
+	user.LastLogin = time.Now()
+	database.DB.Model(&user).Update("last_login", user.LastLogin)
+
+	// Create audit log for successful login
+	createAuthAudit(c, user.ID, models.ActionLogin, true, "Signed in with passkey "+credential.Name)
+
+	if !assertion.UserVerified {
+		completeSignIn(c, &user, amrHardwareKey, http.StatusOK)
+		return
+	}
+
+	tokenResponse, err := generateTokens(c, &user, amrHardwareKey, amrMFA)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"mis-system/database"
+	"mis-system/models"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// passkeyLoginAllowList requests passkey sign-in options for the email and returns the allowed credential IDs
+func passkeyLoginAllowList(t *testing.T, email string) []string {
+	t.Helper()
+
+	w := performJSON(GetPasskeyLoginOptions, http.MethodPost, PasskeyLoginOptionsRequest{Email: email}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("options status = %d: %s", w.Code, w.Body)
+	}
+
+	publicKey := decodeJSON(t, w)["data"].(map[string]interface{})["publicKey"].(map[string]interface{})
+	var ids []string
+	for _, descriptor := range publicKey["allowCredentials"].([]interface{}) {
+		ids = append(ids, descriptor.(map[string]interface{})["id"].(string))
+	}
+	return ids
+}
+
+func TestGetPasskeyLoginOptionsDoesNotRevealAccounts(t *testing.T) {
+	setupTestDB(t)
+	withPasskey := createTestUser(t, "passkey@example.com", "")
+	createTestUser(t, "nopasskey@example.com", "old password 1")
+	if err := database.DB.Create(&models.WebAuthnCredential{
+		UserID:       withPasskey.ID,
+		CredentialID: "cmVhbC1jcmVkZW50aWFs",
+		PublicKey:    []byte{0},
+		Name:         "Passkey",
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := passkeyLoginAllowList(t, withPasskey.Email); !reflect.DeepEqual(got, []string{"cmVhbC1jcmVkZW50aWFs"}) {
+		t.Errorf("allowCredentials for an account with a passkey = %v", got)
+	}
+
+	for _, email := range []string{"unknown@example.com", "nopasskey@example.com"} {
+		first := passkeyLoginAllowList(t, email)
+		if len(first) != 1 {
+			t.Fatalf("allowCredentials for %s = %v, want one decoy", email, first)
+		}
+		if again := passkeyLoginAllowList(t, email); !reflect.DeepEqual(again, first) {
+			t.Errorf("allowCredentials for %s changed from %v to %v", email, first, again)
+		}
+	}
+
+	if a, b := passkeyLoginAllowList(t, "a@example.com"), passkeyLoginAllowList(t, "b@example.com"); reflect.DeepEqual(a, b) {
+		t.Errorf("two unknown emails share the decoy %v", a)
+	}
+
+	// Without an email the browser offers the passkeys stored on the device
+	w := performJSON(GetPasskeyLoginOptions, http.MethodPost, nil, nil)
+	publicKey := decodeJSON(t, w)["data"].(map[string]interface{})["publicKey"].(map[string]interface{})
+	if allow := publicKey["allowCredentials"].([]interface{}); len(allow) != 0 {
+		t.Errorf("allowCredentials without an email = %v, want none", allow)
+	}
+}
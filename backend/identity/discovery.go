@@ -0,0 +1,54 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Metadata holds the parts of an OpenID Provider's discovery document that the code flow needs
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgorithms     []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Discover fetches and validates the discovery document published under issuer
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Metadata, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("identity: discovery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("identity: discovery: %s returned %s", url, resp.Status)
+	}
+
+	var meta Metadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("identity: discovery: %w", err)
+	}
+
+	// The document must describe the issuer it was fetched from (OpenID Connect Discovery 4.3)
+	if meta.Issuer != issuer {
+		return nil, fmt.Errorf("identity: discovery: issuer %q does not match %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("identity: discovery: %s is missing required endpoints", url)
+	}
+
+	return &meta, nil
+}
@@ -0,0 +1,235 @@
+// Package identity signs users in through external OpenID Connect providers.
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mis-system/idtoken"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoIDToken is returned when a token response carries no ID token
+var ErrNoIDToken = errors.New("identity: token response has no id_token")
+
+// Algorithms the ID token verifier can check
+var supportedAlgorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Config describes one OpenID Connect provider
+type Config struct {
+	Name         string // Short name used in routes and stored on linked identities
+	DisplayName  string
+	Issuer       string
+	ExtraIssuers []string // Additional iss values the provider uses in ID tokens
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	TrustEmail   bool          // Treat emails as verified when the provider sends no email_verified claim
+	ClockSkew    time.Duration // Leeway on ID token timestamps
+	Metadata     *Metadata     // Static endpoints; when nil they are discovered from the issuer
+}
+
+// Profile is the identity asserted by a provider after sign-in
+type Profile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+	Picture       string
+	Nonce         string
+}
+
+// Provider runs the authorization code flow against one OpenID Connect provider.
+// Endpoints are discovered on first use so an unreachable provider does not block startup.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	meta     *Metadata
+	verifier *idtoken.Verifier
+}
+
+// New returns a provider for config
+func New(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the provider's short name
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// DisplayName returns the provider's human-readable name
+func (p *Provider) DisplayName() string {
+	if p.config.DisplayName != "" {
+		return p.config.DisplayName
+	}
+	return p.config.Name
+}
+
+// AuthCodeURL returns the provider's authorization URL for state
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	if err := p.setup(ctx); err != nil {
+		return "", err
+	}
+
+	return p.oauth.AuthCodeURL(state, opts...), nil
+}
+
+// Exchange redeems an authorization code and returns the verified profile from its ID token.
+// Profile claims missing from the ID token are filled in from the userinfo endpoint.
+func (p *Provider) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*Profile, error) {
+	if err := p.setup(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := p.oauth.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("identity: exchange code: %w", err)
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, ErrNoIDToken
+	}
+
+	var claims idtoken.Claims
+	if err := p.verifier.Verify(ctx, rawIDToken, &claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Email == "" && p.meta.UserinfoEndpoint != "" {
+		if err := p.fetchUserinfo(ctx, token, &claims); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.profile(&claims), nil
+}
+
+// profile converts verified claims to the provider's profile.
+// TrustEmail only stands in for a missing email_verified claim; a provider that says the email is unverified is believed.
+func (p *Provider) profile(claims *idtoken.Claims) *Profile {
+	verified := claims.EmailVerified.Value()
+	if claims.EmailVerified == nil {
+		verified = p.config.TrustEmail
+	}
+
+	return &Profile{
+		Provider:      p.config.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Picture:       claims.Picture,
+		Nonce:         claims.Nonce,
+	}
+}
+
+// fetchUserinfo completes claims from the userinfo endpoint, which must describe the same subject
+func (p *Provider) fetchUserinfo(ctx context.Context, token *oauth2.Token, claims *idtoken.Claims) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.meta.UserinfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.oauth.Client(ctx, token).Do(req)
+	if err != nil {
+		return fmt.Errorf("identity: userinfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("identity: userinfo: %s", resp.Status)
+	}
+
+	var info idtoken.Claims
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("identity: userinfo: %w", err)
+	}
+	if info.Subject != claims.Subject {
+		return errors.New("identity: userinfo subject does not match the ID token")
+	}
+
+	claims.Email = info.Email
+	claims.EmailVerified = info.EmailVerified
+	if claims.Name == "" {
+		claims.Name = info.Name
+	}
+	if claims.GivenName == "" {
+		claims.GivenName = info.GivenName
+	}
+	if claims.FamilyName == "" {
+		claims.FamilyName = info.FamilyName
+	}
+	if claims.Picture == "" {
+		claims.Picture = info.Picture
+	}
+
+	return nil
+}
+
+// setup resolves the provider's endpoints and builds its OAuth client and ID token verifier once
+func (p *Provider) setup(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return nil
+	}
+
+	meta := p.config.Metadata
+	if meta == nil {
+		discovered, err := Discover(ctx, p.client, p.config.Issuer)
+		if err != nil {
+			return err
+		}
+		meta = discovered
+	}
+
+	algorithms := []string{"RS256"}
+	if len(meta.SigningAlgorithms) > 0 {
+		algorithms = slices.DeleteFunc(slices.Clone(meta.SigningAlgorithms), func(alg string) bool {
+			return !slices.Contains(supportedAlgorithms, alg)
+		})
+	}
+
+	p.meta = meta
+	p.verifier = &idtoken.Verifier{
+		Keys:       idtoken.NewRemoteKeySource(meta.JWKSURI),
+		Issuers:    append([]string{meta.Issuer}, p.config.ExtraIssuers...),
+		Audience:   p.config.ClientID,
+		Algorithms: algorithms,
+		ClockSkew:  p.config.ClockSkew,
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  meta.AuthorizationEndpoint,
+			TokenURL: meta.TokenEndpoint,
+		},
+	}
+
+	return nil
+}
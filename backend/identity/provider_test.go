@@ -0,0 +1,35 @@
+package identity
+
+import (
+	"mis-system/idtoken"
+	"testing"
+)
+
+func TestProfileEmailVerified(t *testing.T) {
+	verified, unverified := idtoken.Bool(true), idtoken.Bool(false)
+
+	tests := []struct {
+		name       string
+		claim      *idtoken.Bool // nil when the provider sends no email_verified claim
+		trustEmail bool
+		want       bool
+	}{
+		{"verified claim", &verified, false, true},
+		{"unverified claim", &unverified, false, false},
+		{"missing claim", nil, false, false},
+		{"verified claim, trusted provider", &verified, true, true},
+		{"unverified claim, trusted provider", &unverified, true, false},
+		{"missing claim, trusted provider", nil, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(Config{Name: "test", TrustEmail: tt.trustEmail})
+			claims := &idtoken.Claims{Email: "user@example.com", EmailVerified: tt.claim}
+
+			if got := p.profile(claims).EmailVerified; got != tt.want {
+				t.Errorf("EmailVerified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
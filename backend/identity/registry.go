@@ -0,0 +1,38 @@
+package identity
+
+import (
+	"sort"
+)
+
+// Registry holds the configured providers by name
+type Registry struct {
+	providers map[string]*Provider
+}
+
+// NewRegistry returns a registry of the given providers
+func NewRegistry(providers ...*Provider) *Registry {
+	r := &Registry{providers: make(map[string]*Provider, len(providers))}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Get returns the provider with the given name
+func (r *Registry) Get(name string) (*Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// All returns every provider sorted by name
+func (r *Registry) All() []*Provider {
+	providers := make([]*Provider, 0, len(r.providers))
+	for _, p := range r.providers {
+		providers = append(providers, p)
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name() < providers[j].Name()
+	})
+	return providers
+}
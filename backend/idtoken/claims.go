@@ -0,0 +1,52 @@
+package idtoken
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims holds the standard OpenID Connect ID token claims. Every profile claim is optional,
+// so missing claims decode to their zero value; a missing email_verified claim decodes to nil.
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified *Bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// ClaimSet is implemented by Claims and by provider-specific types that embed it
+type ClaimSet interface {
+	jwt.Claims
+	standard() *Claims
+}
+
+func (c *Claims) standard() *Claims {
+	return c
+}
+
+// Bool decodes a boolean claim that some providers send as the string "true" or "false"
+type Bool bool
+
+// UnmarshalJSON accepts JSON booleans and their string forms; any other value decodes as false
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	*b = Bool(bytes.Equal(data, []byte("true")))
+	return nil
+}
+
+// Value reports whether the claim is present and true
+func (b *Bool) Value() bool {
+	return b != nil && bool(*b)
+}
+
+// MarshalJSON encodes the value as a JSON boolean
+func (b Bool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bool(b))
+}
@@ -0,0 +1,142 @@
+package idtoken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// profileClaims are the optional claims of Claims, in a comparable struct
+type profileClaims struct {
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+	Picture       string
+}
+
+func TestClaimsMissingOptionalClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		want   profileClaims
+	}{
+		{
+			name: "full profile",
+			modify: func(c jwt.MapClaims) {
+				c["name"] = "Ada Lovelace"
+				c["given_name"] = "Ada"
+				c["family_name"] = "Lovelace"
+				c["picture"] = "https://example.com/ada.png"
+			},
+			want: profileClaims{Email: "user@example.com", EmailVerified: true, Name: "Ada Lovelace", GivenName: "Ada",
+				FamilyName: "Lovelace", Picture: "https://example.com/ada.png"},
+		},
+		{
+			name:   "no name, picture or given and family name",
+			modify: func(jwt.MapClaims) {},
+			want:   profileClaims{Email: "user@example.com", EmailVerified: true},
+		},
+		{
+			name:   "only a given name",
+			modify: func(c jwt.MapClaims) { c["given_name"] = "Ada" },
+			want:   profileClaims{Email: "user@example.com", EmailVerified: true, GivenName: "Ada"},
+		},
+		{
+			name:   "no email",
+			modify: func(c jwt.MapClaims) { delete(c, "email"); delete(c, "email_verified") },
+			want:   profileClaims{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+
+			var decoded Claims
+			if err := testVerifier(t).Verify(context.Background(), signTestToken(t, testKID, claims), &decoded); err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			got := profileClaims{
+				Email:         decoded.Email,
+				EmailVerified: decoded.EmailVerified.Value(),
+				Name:          decoded.Name,
+				GivenName:     decoded.GivenName,
+				FamilyName:    decoded.FamilyName,
+				Picture:       decoded.Picture,
+			}
+			if got != tt.want {
+				t.Errorf("decoded profile = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailVerifiedClaim(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        interface{} // Value of email_verified; nil leaves the claim out
+		wantVerified bool
+		wantPresent  bool
+	}{
+		{"boolean true", true, true, true},
+		{"boolean false", false, false, true},
+		{"string true", "true", true, true},
+		{"string false", "false", false, true},
+		{"missing", nil, false, false},
+		{"unexpected value", "yes", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			delete(claims, "email_verified")
+			if tt.value != nil {
+				claims["email_verified"] = tt.value
+			}
+			raw := signTestToken(t, testKID, claims)
+
+			var decoded Claims
+			if err := testVerifier(t).Verify(context.Background(), raw, &decoded); err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if decoded.EmailVerified.Value() != tt.wantVerified {
+				t.Errorf("EmailVerified = %v, want %v", decoded.EmailVerified.Value(), tt.wantVerified)
+			}
+			if present := decoded.EmailVerified != nil; present != tt.wantPresent {
+				t.Errorf("EmailVerified present = %v, want %v", present, tt.wantPresent)
+			}
+
+			// Verifiers that require a verified email only accept the same tokens
+			strict := testVerifier(t)
+			strict.RequireVerifiedEmail = true
+			err := strict.Verify(context.Background(), raw, &Claims{})
+			if tt.wantVerified && err != nil {
+				t.Errorf("strict Verify() error = %v", err)
+			}
+			if !tt.wantVerified && !errors.Is(err, ErrEmailNotVerified) {
+				t.Errorf("strict Verify() error = %v, want %v", err, ErrEmailNotVerified)
+			}
+		})
+	}
+}
+
+func TestBoolMarshalJSON(t *testing.T) {
+	for _, value := range []Bool{true, false} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Bool
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != value {
+			t.Errorf("round trip of %v = %v (%s), %v", value, decoded, data, err)
+		}
+	}
+}
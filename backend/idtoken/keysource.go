@@ -0,0 +1,182 @@
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mis-system/jwk"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when no key in the set matches a token's kid
+var ErrUnknownKey = errors.New("idtoken: unknown signing key")
+
+// KeySource resolves the public key that signed an ID token
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeySource serves keys from a fixed set, for tests and pinned deployments
+type StaticKeySource struct {
+	Set jwk.Set
+}
+
+// Key returns the key with the given kid
+func (s StaticKeySource) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok := s.Set.Lookup(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key.PublicKey()
+}
+
+const (
+	defaultCacheTTL = time.Hour
+	minCacheTTL     = time.Minute
+	maxCacheTTL     = 24 * time.Hour
+	minRefetchDelay = time.Minute // Unknown kids trigger at most one early refetch per minute
+)
+
+// RemoteKeySource fetches a JWKS over HTTP and caches it for the lifetime given by the
+// response's Cache-Control max-age. Unknown kids trigger an early refetch so rotated keys are
+// picked up, and a stale set keeps being used if a refetch fails. Downloads happen outside the
+// lock and are shared by concurrent callers, so a slow fetch never blocks lookups of cached keys.
+type RemoteKeySource struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	set       jwk.Set
+	expiresAt time.Time
+	fetchedAt time.Time
+	inflight  *keyFetch // Download in progress, if any
+}
+
+// keyFetch is a download of the key set that callers can wait on
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRemoteKeySource returns a key source backed by the JWKS at url
+func NewRemoteKeySource(url string) *RemoteKeySource {
+	return &RemoteKeySource{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the key with the given kid, refreshing the cached set when it has expired or lacks the kid
+func (s *RemoteKeySource) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	now := time.Now()
+	key, found := s.set.Lookup(kid)
+	stale := now.After(s.expiresAt)
+	refetch := stale || now.Sub(s.fetchedAt) >= minRefetchDelay || s.inflight != nil
+	s.mu.Unlock()
+
+	if found && !stale {
+		return key.PublicKey()
+	}
+
+	if refetch {
+		if err := s.refetch(ctx); err != nil {
+			if !found {
+				return nil, err
+			}
+			log.Printf("idtoken: using cached keys: %v", err)
+		}
+
+		s.mu.Lock()
+		key, found = s.set.Lookup(kid)
+		s.mu.Unlock()
+	}
+
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	return key.PublicKey()
+}
+
+// refetch downloads the key set, or waits for the download another caller already started
+func (s *RemoteKeySource) refetch(ctx context.Context) error {
+	s.mu.Lock()
+	if f := s.inflight; f != nil {
+		s.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f := &keyFetch{done: make(chan struct{})}
+	s.inflight = f
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	set, ttl, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	if err == nil {
+		s.set = set
+		s.expiresAt = time.Now().Add(ttl)
+	}
+	s.inflight = nil
+	s.mu.Unlock()
+
+	f.err = err
+	close(f.done)
+	return err
+}
+
+// fetch downloads the key set and returns it with its cache lifetime
+func (s *RemoteKeySource) fetch(ctx context.Context) (jwk.Set, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return jwk.Set{}, 0, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return jwk.Set{}, 0, fmt.Errorf("idtoken: fetch keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return jwk.Set{}, 0, fmt.Errorf("idtoken: fetch keys: %s", resp.Status)
+	}
+
+	var set jwk.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return jwk.Set{}, 0, fmt.Errorf("idtoken: decode keys: %w", err)
+	}
+
+	return set, cacheTTL(resp.Header.Get("Cache-Control")), nil
+}
+
+// cacheTTL reads max-age from a Cache-Control header, clamped to sensible bounds
+func cacheTTL(header string) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			break
+		}
+		ttl := time.Duration(seconds) * time.Second
+		return min(max(ttl, minCacheTTL), maxCacheTTL)
+	}
+
+	return defaultCacheTTL
+}
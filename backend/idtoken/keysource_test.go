@@ -0,0 +1,81 @@
+package idtoken
+
+import (
+	"context"
+	"encoding/json"
+	"mis-system/jwk"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRemoteKeySourceFetchDoesNotBlockCachedKeys(t *testing.T) {
+	key, err := jwk.New(testKID, jwt.SigningMethodRS256.Alg(), &testKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every download after the first hangs until the test releases it
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.Key{key}})
+	}))
+	defer server.Close()
+
+	source := NewRemoteKeySource(server.URL)
+	ctx := context.Background()
+	if _, err := source.Key(ctx, testKID); err != nil {
+		t.Fatalf("first Key() error = %v", err)
+	}
+
+	// Let the early refetch for unknown kids become due
+	source.mu.Lock()
+	source.fetchedAt = time.Now().Add(-minRefetchDelay)
+	source.mu.Unlock()
+
+	// Several lookups of an unknown kid start a single, slow download
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := source.Key(ctx, "rotated-key"); err != ErrUnknownKey {
+				t.Errorf("Key(unknown) error = %v, want %v", err, ErrUnknownKey)
+			}
+		}()
+	}
+	for requests.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Cached keys keep resolving while that download is stuck
+	done := make(chan error, 1)
+	go func() {
+		_, err := source.Key(ctx, testKID)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Key(cached) error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Key(cached) blocked on the JWKS download")
+	}
+
+	close(release)
+	wg.Wait()
+	if n := requests.Load(); n != 2 {
+		t.Errorf("JWKS downloaded %d times, want 2", n)
+	}
+}
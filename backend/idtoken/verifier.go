@@ -0,0 +1,66 @@
+// Package idtoken verifies OpenID Connect ID tokens locally against the issuer's published keys.
+package idtoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMalformed        = errors.New("idtoken: malformed token")
+	ErrInvalidIssuer    = errors.New("idtoken: invalid issuer")
+	ErrEmailNotVerified = errors.New("idtoken: email not verified")
+)
+
+// Verifier checks the signature and standard claims of ID tokens
+type Verifier struct {
+	Keys                 KeySource
+	Issuers              []string      // Accepted iss values
+	Audience             string        // Expected aud, normally the OAuth client ID
+	Algorithms           []string      // Accepted signing algorithms; defaults to RS256
+	ClockSkew            time.Duration // Leeway applied to exp, iat and nbf
+	RequireVerifiedEmail bool          // Reject tokens whose email_verified claim is not true
+}
+
+// Verify validates raw and decodes its claims into claims
+func (v *Verifier) Verify(ctx context.Context, raw string, claims ClaimSet) error {
+	algorithms := v.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{jwt.SigningMethodRS256.Alg()}
+	}
+
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.Keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods(algorithms),
+		jwt.WithAudience(v.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.ClockSkew),
+	)
+	if errors.Is(err, jwt.ErrTokenMalformed) {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if err != nil {
+		return fmt.Errorf("idtoken: %w", err)
+	}
+
+	standard := claims.standard()
+	if standard.Subject == "" {
+		return fmt.Errorf("%w: missing sub claim", ErrMalformed)
+	}
+	if !slices.Contains(v.Issuers, standard.Issuer) {
+		return ErrInvalidIssuer
+	}
+	if v.RequireVerifiedEmail && !standard.EmailVerified.Value() {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package idtoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"mis-system/jwk"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "client-id"
+	testKID      = "test-key"
+)
+
+// testKey signs every token in the package tests; generating RSA keys is slow, so it is shared
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// testVerifier returns a verifier that trusts testKey under testKID
+func testVerifier(t *testing.T) *Verifier {
+	t.Helper()
+
+	key, err := jwk.New(testKID, jwt.SigningMethodRS256.Alg(), &testKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Verifier{
+		Keys:      StaticKeySource{Set: jwk.Set{Keys: []jwk.Key{key}}},
+		Issuers:   []string{testIssuer},
+		Audience:  testAudience,
+		ClockSkew: time.Minute,
+	}
+}
+
+// validClaims returns the claims of a token testVerifier accepts
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            testIssuer,
+		"aud":            testAudience,
+		"sub":            "subject-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+// signTestToken signs claims with testKey under kid
+func signTestToken(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		kid     string
+		modify  func(claims jwt.MapClaims)
+		wantErr error // nil when the token must verify; matched with errors.Is
+	}{
+		{name: "valid token", kid: testKID, modify: func(jwt.MapClaims) {}},
+		{name: "wrong audience", kid: testKID, modify: func(c jwt.MapClaims) { c["aud"] = "another-client" }, wantErr: jwt.ErrTokenInvalidAudience},
+		{name: "wrong issuer", kid: testKID, modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: ErrInvalidIssuer},
+		{name: "missing subject", kid: testKID, modify: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: ErrMalformed},
+		{name: "missing expiry", kid: testKID, modify: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: jwt.ErrTokenRequiredClaimMissing},
+		{name: "expired within the clock skew", kid: testKID, modify: func(c jwt.MapClaims) { c["exp"] = now.Add(-30 * time.Second).Unix() }},
+		{name: "expired beyond the clock skew", kid: testKID, modify: func(c jwt.MapClaims) { c["exp"] = now.Add(-2 * time.Minute).Unix() }, wantErr: jwt.ErrTokenExpired},
+		{name: "issued in the future within the clock skew", kid: testKID, modify: func(c jwt.MapClaims) { c["iat"] = now.Add(30 * time.Second).Unix() }},
+		{name: "issued in the future beyond the clock skew", kid: testKID, modify: func(c jwt.MapClaims) { c["iat"] = now.Add(2 * time.Minute).Unix() }, wantErr: jwt.ErrTokenUsedBeforeIssued},
+		{name: "unknown kid", kid: "other-key", modify: func(jwt.MapClaims) {}, wantErr: ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+
+			var decoded Claims
+			err := testVerifier(t).Verify(context.Background(), signTestToken(t, tt.kid, claims), &decoded)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if decoded.Subject != "subject-1" || decoded.Email != "user@example.com" {
+					t.Errorf("decoded claims = %+v", decoded)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsTamperedSignature(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+	token.Header["kid"] = testKID
+	signed, err := token.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testVerifier(t).Verify(context.Background(), signed, &Claims{}); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("Verify() error = %v, want %v", err, jwt.ErrTokenSignatureInvalid)
+	}
+}
+
+func TestVerifyRejectsUnexpectedAlgorithm(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	token.Header["kid"] = testKID
+	signed, err := token.SignedString([]byte("shared secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testVerifier(t).Verify(context.Background(), signed, &Claims{}); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Errorf("Verify() error = %v, want %v", err, jwt.ErrTokenSignatureInvalid)
+	}
+}
@@ -0,0 +1,147 @@
+// Package jwk converts between public keys and JSON Web Keys (RFC 7517).
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key is a public JSON Web Key
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA public exponent
+	Crv string `json:"crv,omitempty"` // EC or OKP curve
+	X   string `json:"x,omitempty"`   // EC x coordinate or OKP public key
+	Y   string `json:"y,omitempty"`   // EC y coordinate
+}
+
+// Set is a JSON Web Key Set as served from a jwks.json endpoint
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// New builds a signature-verification JWK for an RSA or Ed25519 public key
+func New(kid, alg string, pub crypto.PublicKey) (Key, error) {
+	key := Key{Kid: kid, Use: "sig", Alg: alg}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = encode(k.N.Bytes())
+		key.E = encode(big.NewInt(int64(k.E)).Bytes())
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = encode(k)
+	default:
+		return Key{}, fmt.Errorf("jwk: unsupported public key type %T", pub)
+	}
+
+	return key, nil
+}
+
+// PublicKey decodes the key material of a JWK
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("jwk: invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("jwk: unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("jwk: invalid EC key")
+		}
+		// Parsing the uncompressed point rejects coordinates that are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdhCurves[k.Crv].NewPublicKey(point); err != nil {
+			return nil, errors.New("jwk: invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwk: unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwk: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("jwk: unsupported key type %q", k.Kty)
+	}
+}
+
+// Lookup returns the key with the given kid
+func (s Set) Lookup(kid string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.Kid == kid {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
+
+// Curves accepted for EC keys, as used by ES256, ES384 and ES512
+var (
+	curves = map[string]elliptic.Curve{
+		"P-256": elliptic.P256(),
+		"P-384": elliptic.P384(),
+		"P-521": elliptic.P521(),
+	}
+	ecdhCurves = map[string]ecdh.Curve{
+		"P-256": ecdh.P256(),
+		"P-384": ecdh.P384(),
+		"P-521": ecdh.P521(),
+	}
+)
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("jwk: %w", err)
+	}
+	return b, nil
+}
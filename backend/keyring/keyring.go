@@ -0,0 +1,372 @@
+// Package keyring manages the asymmetric keys used to sign access tokens.
+//
+// Keys are persisted in the signing_keys table so every server instance signs with the same key.
+// The newest unretired key signs; retired keys keep verifying (and stay in the JWKS) until their
+// grace period ends, so tokens issued shortly before a rotation remain valid.
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"mis-system/jwk"
+	"mis-system/models"
+	"mis-system/secretbox"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownKey is returned when a token names a kid that is not in the keyring
+var ErrUnknownKey = errors.New("keyring: unknown signing key")
+
+// ErrNoCurrentKey is returned when no unretired key is available to sign with
+var ErrNoCurrentKey = errors.New("keyring: no current signing key")
+
+// Options configures a Keyring
+type Options struct {
+	Algorithm        string        // RS256 or EdDSA
+	RotationInterval time.Duration // How long a key signs before a new one replaces it
+	RetirementGrace  time.Duration // How long a retired key keeps verifying
+	Box              *secretbox.Box
+}
+
+// Key is a signing key loaded from the database
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	RetiredAt time.Time
+	ExpiresAt time.Time
+	signer    crypto.Signer
+}
+
+// PublicKey returns the verification half of the key
+func (k *Key) PublicKey() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// Keyring signs tokens with the current key and verifies them against every unexpired key
+type Keyring struct {
+	db   *gorm.DB
+	opts Options
+
+	mu      sync.RWMutex
+	current *Key
+	keys    map[string]*Key
+}
+
+// New loads the keyring from the database, generating a key if none is usable
+func New(db *gorm.DB, opts Options) (*Keyring, error) {
+	if _, err := signingMethod(opts.Algorithm); err != nil {
+		return nil, err
+	}
+
+	r := &Keyring{db: db, opts: opts, keys: make(map[string]*Key)}
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Run reloads keys and rotates the current key when due until ctx is cancelled
+func (r *Keyring) Run(ctx context.Context) {
+	interval := r.opts.RotationInterval / 10
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(); err != nil {
+				log.Printf("keyring: %v", err)
+			}
+		}
+	}
+}
+
+// Sign signs claims with the current key, setting the kid header
+func (r *Keyring) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	key := r.current
+	r.mu.RUnlock()
+	if key == nil {
+		return "", ErrNoCurrentKey
+	}
+
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// Keyfunc resolves the verification key for a token by its kid header, for use with jwt.Parse
+func (r *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	r.mu.RUnlock()
+	if !ok || (!key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt)) {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("keyring: key %s does not sign with %s", kid, token.Method.Alg())
+	}
+
+	return key.PublicKey(), nil
+}
+
+// Methods lists the signing algorithms the keyring can produce, for jwt.WithValidMethods
+func (r *Keyring) Methods() []string {
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// JWKS returns the public keys that can currently verify tokens, newest first
+func (r *Keyring) JWKS() jwk.Set {
+	r.mu.RLock()
+	keys := make([]*Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	set := jwk.Set{Keys: []jwk.Key{}}
+	now := time.Now()
+	for _, key := range keys {
+		if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			continue
+		}
+		k, err := jwk.New(key.ID, key.Algorithm, key.PublicKey())
+		if err != nil {
+			log.Printf("keyring: %v", err)
+			continue
+		}
+		set.Keys = append(set.Keys, k)
+	}
+
+	return set
+}
+
+// Rotate retires the current key and makes a newly generated key current
+func (r *Keyring) Rotate() error {
+	r.mu.RLock()
+	current := r.current
+	r.mu.RUnlock()
+
+	if err := r.rotate(current); err != nil {
+		return err
+	}
+
+	return r.load()
+}
+
+// refresh reloads the keys, rotating first when the current key is missing, stale or uses another algorithm
+func (r *Keyring) refresh() error {
+	keys, current, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	if current != nil && current.Algorithm == r.opts.Algorithm &&
+		time.Since(current.CreatedAt) < r.opts.RotationInterval {
+		r.publish(keys, current)
+		return nil
+	}
+
+	if err := r.rotate(current); err != nil {
+		return err
+	}
+
+	return r.load()
+}
+
+// rotate stores a new key and retires current. When another instance already retired current,
+// its replacement is used instead and no key is generated.
+func (r *Keyring) rotate(current *Key) error {
+	record, err := r.generate()
+	if err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Drop keys whose grace period has ended
+		if err := tx.Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+			Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+
+		// Without a usable current key, any unretired key left over is unreadable and is retired as well
+		retire := tx.Model(&models.SigningKey{}).Where("retired_at IS NULL")
+		if current != nil {
+			retire = retire.Where("kid = ?", current.ID)
+		}
+		result := retire.Updates(map[string]interface{}{
+			"retired_at": now,
+			"expires_at": now.Add(r.opts.RetirementGrace),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if current != nil && result.RowsAffected == 0 {
+			return nil
+		}
+
+		return tx.Create(record).Error
+	})
+}
+
+// generate creates a new key for the configured algorithm and seals its private half
+func (r *Keyring) generate() (*models.SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch r.opts.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := r.opts.Box.Seal(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:        uuid.New().String(),
+		Algorithm:  r.opts.Algorithm,
+		PrivateKey: sealed,
+	}, nil
+}
+
+// load replaces the in-memory keys with the unexpired keys stored in the database.
+// The keys in memory are kept when the database holds no usable current key, so Sign never loses its key.
+func (r *Keyring) load() error {
+	keys, current, err := r.read()
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrNoCurrentKey
+	}
+
+	r.publish(keys, current)
+	return nil
+}
+
+// read loads the unexpired keys stored in the database and picks the newest unretired one as current
+func (r *Keyring) read() (map[string]*Key, *Key, error) {
+	var records []models.SigningKey
+	if err := r.db.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC, id DESC").
+		Find(&records).Error; err != nil {
+		return nil, nil, fmt.Errorf("keyring: load keys: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(records))
+	var current *Key
+	for _, record := range records {
+		key, err := r.open(record)
+		if err != nil {
+			// Keys sealed under a previous secret cannot be used; a fresh key replaces them
+			log.Printf("keyring: skipping key %s: %v", record.KID, err)
+			continue
+		}
+		keys[key.ID] = key
+		if current == nil && key.RetiredAt.IsZero() {
+			current = key
+		}
+	}
+
+	return keys, current, nil
+}
+
+// publish makes keys and current the keyring's keys
+func (r *Keyring) publish(keys map[string]*Key, current *Key) {
+	r.mu.Lock()
+	r.keys = keys
+	r.current = current
+	r.mu.Unlock()
+}
+
+// open decrypts a stored key
+func (r *Keyring) open(record models.SigningKey) (*Key, error) {
+	der, err := r.opts.Box.Open(record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer crypto.Signer
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		signer = k
+	case ed25519.PrivateKey:
+		signer = k
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	return &Key{
+		ID:        record.KID,
+		Algorithm: record.Algorithm,
+		CreatedAt: record.CreatedAt,
+		RetiredAt: record.RetiredAt,
+		ExpiresAt: record.ExpiresAt,
+		signer:    signer,
+	}, nil
+}
+
+// signingMethod maps an algorithm name to its JWT signing method
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("keyring: unsupported algorithm %q", alg)
+	}
+}
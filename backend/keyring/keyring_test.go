@@ -0,0 +1,146 @@
+package keyring
+
+import (
+	"mis-system/models"
+	"mis-system/secretbox"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "keys.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SigningKey{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testOptions(t *testing.T, secret string) Options {
+	t.Helper()
+
+	box, err := secretbox.New(secret, "signing-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Options{
+		Algorithm:        jwt.SigningMethodEdDSA.Alg(),
+		RotationInterval: time.Hour,
+		RetirementGrace:  time.Hour,
+		Box:              box,
+	}
+}
+
+// signAndVerify signs a token with the keyring and parses it back with the keyring's keys
+func signAndVerify(t *testing.T, r *Keyring) {
+	t.Helper()
+
+	signed, err := r.Sign(jwt.RegisteredClaims{Subject: "user"})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if _, err := jwt.Parse(signed, r.Keyfunc, jwt.WithValidMethods(r.Methods())); err != nil {
+		t.Fatalf("parse signed token: %v", err)
+	}
+}
+
+func TestKeyringAlwaysHasCurrentKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, db *gorm.DB) // Changes the stored keys after a first instance created one
+	}{
+		{
+			name:    "stored key is usable",
+			prepare: func(t *testing.T, db *gorm.DB) {},
+		},
+		{
+			name: "stored keys sealed under another secret",
+			prepare: func(t *testing.T, db *gorm.DB) {
+				db.Where("1 = 1").Delete(&models.SigningKey{})
+				if _, err := New(db, testOptions(t, "a previous secret that is long enough")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "every stored key retired by another instance",
+			prepare: func(t *testing.T, db *gorm.DB) {
+				db.Model(&models.SigningKey{}).Where("retired_at IS NULL").Updates(map[string]interface{}{
+					"retired_at": time.Now(),
+					"expires_at": time.Now().Add(time.Hour),
+				})
+			},
+		},
+		{
+			name: "every stored key expired",
+			prepare: func(t *testing.T, db *gorm.DB) {
+				db.Model(&models.SigningKey{}).Where("1 = 1").Updates(map[string]interface{}{
+					"retired_at": time.Now().Add(-2 * time.Hour),
+					"expires_at": time.Now().Add(-time.Hour),
+				})
+			},
+		},
+	}
+
+	const secret = "the current secret that is long enough"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			r, err := New(db, testOptions(t, secret))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			tt.prepare(t, db)
+
+			// A running instance picks the change up on its next refresh
+			if err := r.refresh(); err != nil {
+				t.Fatalf("refresh() error = %v", err)
+			}
+			signAndVerify(t, r)
+
+			// A new instance starting now can sign as well
+			started, err := New(db, testOptions(t, secret))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			signAndVerify(t, started)
+		})
+	}
+}
+
+func TestLoadKeepsKeysWithoutCurrentKey(t *testing.T) {
+	db := newTestDB(t)
+	r, err := New(db, testOptions(t, "the current secret that is long enough"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance retired the key but its replacement is not readable yet
+	db.Model(&models.SigningKey{}).Where("retired_at IS NULL").Updates(map[string]interface{}{
+		"retired_at": time.Now(),
+		"expires_at": time.Now().Add(time.Hour),
+	})
+
+	if err := r.load(); err != ErrNoCurrentKey {
+		t.Fatalf("load() error = %v, want %v", err, ErrNoCurrentKey)
+	}
+	signAndVerify(t, r)
+}
+
+func TestSignWithoutCurrentKey(t *testing.T) {
+	var r Keyring
+	if _, err := r.Sign(jwt.RegisteredClaims{}); err != ErrNoCurrentKey {
+		t.Errorf("Sign() error = %v, want %v", err, ErrNoCurrentKey)
+	}
+}
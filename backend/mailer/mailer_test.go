@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// part is a decoded body of a rendered message
+type part struct {
+	contentType string
+	body        string
+}
+
+// parseMessage reads a rendered message back and returns its headers and decoded bodies
+func parseMessage(t *testing.T, data []byte) (mail.Header, []part) {
+	t.Helper()
+
+	if bytes.Contains(bytes.ReplaceAll(data, []byte("\r\n"), nil), []byte("\n")) {
+		t.Error("message has bare LF line endings")
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("Content-Type: %v", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return msg.Header, []part{decodePart(t, msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)}
+	}
+
+	var parts []part
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextRawPart() error = %v", err)
+		}
+		parts = append(parts, decodePart(t, p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p))
+	}
+	return msg.Header, parts
+}
+
+func decodePart(t *testing.T, contentType, encoding string, r io.Reader) part {
+	t.Helper()
+
+	if encoding != "quoted-printable" {
+		t.Errorf("Content-Transfer-Encoding = %q, want quoted-printable", encoding)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(r))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	// Line breaks are sent as CRLF
+	return part{contentType: contentType, body: strings.ReplaceAll(string(body), "\r\n", "\n")}
+}
+
+func TestMessageBytes(t *testing.T) {
+	longLine := strings.Repeat("a long line that needs soft breaks ", 10)
+
+	tests := []struct {
+		name      string
+		msg       Message
+		wantErr   bool
+		wantParts []part
+	}{
+		{
+			name: "plain text",
+			msg:  Message{From: "UESS <no-reply@example.com>", To: []string{"ann@example.com"}, Subject: "Hello", Text: "Hi Ann\n" + longLine},
+			wantParts: []part{
+				{"text/plain; charset=utf-8", "Hi Ann\n" + longLine},
+			},
+		},
+		{
+			name: "HTML only",
+			msg:  Message{From: "no-reply@example.com", To: []string{"ann@example.com"}, Subject: "Hello", HTML: "<p>Hi Ann</p>"},
+			wantParts: []part{
+				{"text/html; charset=utf-8", "<p>Hi Ann</p>"},
+			},
+		},
+		{
+			name: "text and HTML alternatives",
+			msg: Message{From: "no-reply@example.com", To: []string{"ann@example.com", "bob@example.com"},
+				Subject: "Réinitialiser le mot de passe", Text: "Hi = Ann", HTML: "<p>Hi Ann</p>"},
+			wantParts: []part{
+				{"text/plain; charset=utf-8", "Hi = Ann"},
+				{"text/html; charset=utf-8", "<p>Hi Ann</p>"},
+			},
+		},
+		{
+			name:    "no sender",
+			msg:     Message{To: []string{"ann@example.com"}, Text: "Hi"},
+			wantErr: true,
+		},
+		{
+			name:    "no recipients",
+			msg:     Message{From: "no-reply@example.com", Text: "Hi"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.msg.Bytes()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Bytes() accepted the message")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bytes() error = %v", err)
+			}
+
+			header, parts := parseMessage(t, data)
+			if got := header.Get("From"); got != tt.msg.From {
+				t.Errorf("From = %q, want %q", got, tt.msg.From)
+			}
+			if got := header.Get("To"); got != strings.Join(tt.msg.To, ", ") {
+				t.Errorf("To = %q", got)
+			}
+			if subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); err != nil || subject != tt.msg.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.msg.Subject)
+			}
+			if _, err := header.Date(); err != nil {
+				t.Errorf("Date: %v", err)
+			}
+			if id := header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+				t.Errorf("Message-ID = %q, want one in the sender's domain", id)
+			}
+			if header.Get("MIME-Version") != "1.0" {
+				t.Errorf("MIME-Version = %q", header.Get("MIME-Version"))
+			}
+
+			if len(parts) != len(tt.wantParts) {
+				t.Fatalf("parts = %+v, want %+v", parts, tt.wantParts)
+			}
+			for i, want := range tt.wantParts {
+				if parts[i] != want {
+					t.Errorf("part %d = %+v, want %+v", i, parts[i], want)
+				}
+			}
+		})
+	}
+}
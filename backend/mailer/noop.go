@@ -0,0 +1,18 @@
+package mailer
+
+import (
+	"context"
+)
+
+// NoopMailer discards every message
+type NoopMailer struct{}
+
+// NewNoopMailer creates a mailer that never delivers anything
+func NewNoopMailer() *NoopMailer {
+	return &NoopMailer{}
+}
+
+// Send implements Mailer
+func (m *NoopMailer) Send(ctx context.Context, msg *Message) error {
+	return nil
+}
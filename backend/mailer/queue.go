@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned by Queue.Send when no more messages can be queued
+	ErrQueueFull = errors.New("mailer: queue is full")
+	// ErrQueueClosed is returned by Queue.Send once the queue has been closed
+	ErrQueueClosed = errors.New("mailer: queue is closed")
+)
+
+// QueueOptions configures a Queue
+type QueueOptions struct {
+	Size       int           // Messages waiting for delivery before Send refuses more
+	Attempts   int           // Deliveries tried per message before it is dropped
+	Timeout    time.Duration // Bound on a single delivery
+	RetryDelay time.Duration // Wait before the second attempt, doubled for each further one
+}
+
+// Queue delivers messages through another Mailer in the background, so Send returns without waiting on the backend.
+// Failed deliveries are retried, and Close delivers whatever is still queued before the process exits.
+type Queue struct {
+	mailer Mailer
+	opts   QueueOptions
+
+	mu       sync.RWMutex
+	closed   bool
+	messages chan *Message
+
+	ctx    context.Context // Cancelled when Close gives up, aborting the delivery in progress
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewQueue starts a queue delivering through m
+func NewQueue(m Mailer, opts QueueOptions) *Queue {
+	if opts.Attempts < 1 {
+		opts.Attempts = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		mailer:   m,
+		opts:     opts,
+		messages: make(chan *Message, opts.Size),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Send implements Mailer by queueing the message for delivery
+func (q *Queue) Send(ctx context.Context, msg *Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones are delivered.
+// If ctx ends first, the delivery in progress is aborted, the rest are dropped and ctx's error is returned.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+		return ctx.Err()
+	}
+}
+
+// run delivers queued messages one at a time until the queue is closed and drained
+func (q *Queue) run() {
+	defer close(q.done)
+	defer q.cancel()
+
+	for msg := range q.messages {
+		if q.ctx.Err() != nil {
+			log.Printf("mailer: dropped message %q to %v: queue closed", msg.Subject, msg.To)
+			continue
+		}
+		if err := q.deliver(msg); err != nil {
+			log.Printf("mailer: failed to deliver %q to %v: %v", msg.Subject, msg.To, err)
+		}
+	}
+}
+
+// deliver sends a message, retrying with exponential backoff
+func (q *Queue) deliver(msg *Message) error {
+	delay := q.opts.RetryDelay
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = q.send(msg); err == nil || attempt == q.opts.Attempts {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-q.ctx.Done():
+			return err
+		}
+	}
+}
+
+// send makes a single delivery attempt
+func (q *Queue) send(msg *Message) error {
+	ctx := q.ctx
+	if q.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.opts.Timeout)
+		defer cancel()
+	}
+
+	return q.mailer.Send(ctx, msg)
+}
@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMailer records deliveries, failing the first ones and optionally holding each until released
+type fakeMailer struct {
+	mu       sync.Mutex
+	failures int           // Attempts that fail before deliveries succeed
+	release  chan struct{} // When not nil, each attempt waits for a value or for its context to end
+	attempts int
+	sent     []*Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg *Message) error {
+	if m.release != nil {
+		select {
+		case <-m.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts++
+	if m.attempts <= m.failures {
+		return errors.New("server unavailable")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) counts() (attempts, sent int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts, len(m.sent)
+}
+
+func TestQueueDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantAttempts int
+		wantSent     int
+	}{
+		{"delivered at once", 0, 1, 1},
+		{"delivered after retries", 2, 3, 1},
+		{"dropped after the last attempt", 5, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeMailer{failures: tt.failures}
+			q := NewQueue(backend, QueueOptions{Size: 10, Attempts: 3, RetryDelay: time.Millisecond})
+
+			if err := q.Send(context.Background(), &Message{Subject: "Hello"}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if err := q.Close(context.Background()); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			attempts, sent := backend.counts()
+			if attempts != tt.wantAttempts || sent != tt.wantSent {
+				t.Errorf("attempts = %d, sent = %d, want %d and %d", attempts, sent, tt.wantAttempts, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestQueueSendDoesNotWait(t *testing.T) {
+	backend := &fakeMailer{release: make(chan struct{})}
+	q := NewQueue(backend, QueueOptions{Size: 1, Attempts: 1})
+
+	// The first message is taken by the worker, which waits on the backend; the second fills the queue
+	for i := 0; i < 2; i++ {
+		if err := q.Send(context.Background(), &Message{}); err != nil {
+			t.Fatalf("Send() %d error = %v", i+1, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := q.Send(context.Background(), &Message{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Send() to a full queue error = %v, want ErrQueueFull", err)
+	}
+
+	// Close delivers everything queued before returning
+	go func() {
+		backend.release <- struct{}{}
+		backend.release <- struct{}{}
+	}()
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, sent := backend.counts(); sent != 2 {
+		t.Errorf("sent = %d, want 2", sent)
+	}
+
+	if err := q.Send(context.Background(), &Message{}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Send() after Close() error = %v, want ErrQueueClosed", err)
+	}
+}
+
+func TestQueueCloseGivesUp(t *testing.T) {
+	backend := &fakeMailer{release: make(chan struct{})} // Never released: the server hangs
+	q := NewQueue(backend, QueueOptions{Size: 10, Attempts: 3, RetryDelay: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if err := q.Send(context.Background(), &Message{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := q.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Close() took %v after its context ended", elapsed)
+	}
+}
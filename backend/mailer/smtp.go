@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPMailer delivers messages through an SMTP server, upgrading the connection with STARTTLS
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// InsecureSkipVerify disables certificate verification; only use it against local test servers
+	InsecureSkipVerify bool
+}
+
+// NewSMTPMailer creates a mailer for the given SMTP server
+func NewSMTPMailer(host string, port int, username, password string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+	}
+}
+
+// Send implements Mailer
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+
+	// Dial with the request context so a slow server cannot block the caller forever
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("mailer: connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	// Require STARTTLS so credentials and message content are never sent in clear text
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		return errors.New("mailer: smtp server does not support STARTTLS")
+	}
+	if err := client.StartTLS(&tls.Config{
+		ServerName:         m.Host,
+		InsecureSkipVerify: m.InsecureSkipVerify,
+	}); err != nil {
+		return fmt.Errorf("mailer: starttls: %w", err)
+	}
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("mailer: authenticate: %w", err)
+		}
+	}
+
+	from, err := envelopeAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("mailer: mail from: %w", err)
+	}
+	for _, to := range msg.To {
+		rcpt, err := envelopeAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("mailer: rcpt to %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: data: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("mailer: write data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: finish data: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// envelopeAddress extracts the bare address from a header value such as "UESS <no-reply@example.com>"
+func envelopeAddress(value string) (string, error) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", fmt.Errorf("mailer: invalid address %q: %w", value, err)
+	}
+	return addr.Address, nil
+}
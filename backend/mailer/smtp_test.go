@@ -0,0 +1,94 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "no-reply@example.com", want: "no-reply@example.com"},
+		{value: "UESS <no-reply@example.com>", want: "no-reply@example.com"},
+		{value: "not an address", wantErr: true},
+		{value: "ann@example.com\r\nRCPT TO:<eve@example.com>", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := envelopeAddress(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("envelopeAddress(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestSMTPRequiresStartTLS checks that nothing is sent to a server that cannot encrypt the connection
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	commands := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer close(commands)
+
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			commands <- strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				conn.Write([]byte("250-localhost\r\n250 AUTH PLAIN\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				conn.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	m := NewSMTPMailer("127.0.0.1", addr.Port, "user", "secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.Send(ctx, &Message{From: "no-reply@example.com", To: []string{"ann@example.com"}, Text: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send() error = %v, want a STARTTLS error", err)
+	}
+
+	ln.Close()
+	for command := range commands {
+		if !strings.HasPrefix(command, "EHLO") && command != "QUIT" {
+			t.Errorf("client sent %q in clear text", command)
+		}
+	}
+}
+
+func TestSMTPInvalidMessage(t *testing.T) {
+	// Messages are checked before connecting, so no server is needed
+	m := NewSMTPMailer("127.0.0.1", 1, "", "")
+	if err := m.Send(context.Background(), &Message{To: []string{"ann@example.com"}}); err == nil ||
+		!strings.Contains(err.Error(), "no sender") {
+		t.Errorf("Send() error = %v, want the message to be refused", err)
+	}
+}
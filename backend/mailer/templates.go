@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var (
+	textTemplates = template.Must(template.ParseFS(templateFS, "templates/*.txt.tmpl"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html.tmpl"))
+)
+
+// Render builds a message from the named template.
+// The plain text template <name>.txt.tmpl must define a "subject" block; <name>.html.tmpl is optional.
+func Render(name string, data interface{}) (*Message, error) {
+	textTmpl := textTemplates.Lookup(name + ".txt.tmpl")
+	if textTmpl == nil {
+		return nil, fmt.Errorf("mailer: unknown template %q", name)
+	}
+
+	var subject, text bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return nil, fmt.Errorf("mailer: render %s subject: %w", name, err)
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("mailer: render %s text: %w", name, err)
+	}
+
+	msg := &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+	}
+
+	if htmlTmpl := htmlTemplates.Lookup(name + ".html.tmpl"); htmlTmpl != nil {
+		var html bytes.Buffer
+		if err := htmlTmpl.Execute(&html, data); err != nil {
+			return nil, fmt.Errorf("mailer: render %s html: %w", name, err)
+		}
+		msg.HTML = html.String()
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data := map[string]interface{}{
+		"FirstName": "<Ann>",
+		"ActionURL": "https://app.example.com/reset-password?token=abc&step=1",
+		"ExpiresIn": "1 hour",
+		"IPAddress": "192.0.2.1",
+		"Time":      "Mon, 02 Jan 2006 15:04 UTC",
+	}
+
+	tests := []struct {
+		name     string
+		wantText []string // Values the plain text body must contain, unescaped
+	}{
+		{"password_reset", []string{"<Ann>", data["ActionURL"].(string), "1 hour"}},
+		{"email_verification", []string{"<Ann>", data["ActionURL"].(string), "1 hour"}},
+		{"invitation", []string{"<Ann>", data["ActionURL"].(string), "1 hour"}},
+		{"password_changed", []string{"<Ann>", "192.0.2.1", data["Time"].(string)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Render(tt.name, data)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			if msg.Subject == "" || strings.ContainsAny(msg.Subject, "\r\n") {
+				t.Errorf("subject = %q, want a single line", msg.Subject)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(msg.Text, want) {
+					t.Errorf("text does not contain %q:\n%s", want, msg.Text)
+				}
+			}
+
+			// The HTML body escapes data, so names cannot inject markup
+			if msg.HTML == "" {
+				t.Fatal("no HTML body")
+			}
+			if strings.Contains(msg.HTML, "<Ann>") || !strings.Contains(msg.HTML, "&lt;Ann&gt;") {
+				t.Errorf("HTML does not escape the name:\n%s", msg.HTML)
+			}
+			if msg.From != "" || len(msg.To) != 0 {
+				t.Errorf("Render() addressed the message: from %q to %v", msg.From, msg.To)
+			}
+		})
+	}
+
+	if _, err := Render("no_such_template", data); err == nil {
+		t.Error("Render() accepted an unknown template")
+	}
+}
@@ -1,9 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"mis-system/config"
 	"mis-system/database"
 	"mis-system/handlers"
+	"mis-system/keyring"
+	"mis-system/models"
+	"mis-system/passwordpolicy"
+	"mis-system/ratelimit"
+	"mis-system/secretbox"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -11,60 +23,216 @@ import (
 )
 
 func main() {
+	// Load configuration
+	cfg, err := config.Load(os.Getenv("MIS_CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if cfg.IsProduction() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
 	// Connect to database
-	database.ConnectDatabase()
+	database.ConnectDatabase(cfg)
+
+	// Load the access token signing keys and rotate them in the background
+	box, err := secretbox.New(cfg.JWT.Secret, "signing-keys")
+	if err != nil {
+		log.Fatalf("Failed to initialize key encryption: %v", err)
+	}
+	keys, err := keyring.New(database.DB, keyring.Options{
+		Algorithm:        cfg.JWT.Algorithm,
+		RotationInterval: cfg.JWT.KeyRotationInterval,
+		RetirementGrace:  cfg.JWT.KeyRetirementGrace,
+		Box:              box,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	go keys.Run(context.Background())
+
+	// Load the breached passwords new passwords are checked against
+	var breached *passwordpolicy.BreachedList
+	if cfg.PasswordPolicy.CheckBreached {
+		breached, err = passwordpolicy.LoadBreachedList(cfg.PasswordPolicy.BreachedListFile)
+		if err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+	}
+
+	// Apply configuration to handlers
+	handlers.Configure(cfg, keys, breached)
+
+	// Rate limits per route group
+	limit := rateLimiter(cfg)
 
 	// Initialize Gin router
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// Configure CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Device-ID"},
+		ExposeHeaders:    exposedHeaders,
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// Routes
 	v1 := router.Group("/api/v1")
 	{
 		// Auth routes
 		auth := v1.Group("/auth")
 		{
-			auth.POST("/register", handlers.RegisterUser)
-			auth.POST("/login", handlers.LoginUser)
-			auth.POST("/google", handlers.GoogleAuth)
-			auth.GET("/google/login", handlers.GoogleLogin)
-			auth.GET("/google/callback", handlers.GoogleCallback)
-			auth.POST("/refresh", handlers.RefreshToken)
+			auth.POST("/register", limit("register"), handlers.RegisterUser)
+			auth.POST("/login", limit("login"), handlers.LoginUser)
+			auth.POST("/google", limit("oauth"), handlers.GoogleAuth)
+			auth.POST("/google/verify", limit("oauth"), handlers.VerifyGoogleToken)
+			auth.GET("/google/login", limit("oauth"), handlers.GoogleLogin)
+			auth.GET("/google/callback", limit("oauth"), handlers.GoogleCallback)
+			auth.GET("/providers", handlers.GetIdentityProviders)
+			auth.GET("/oidc/:provider/login", limit("oauth"), handlers.OIDCLogin)
+			auth.GET("/oidc/:provider/callback", limit("oauth"), handlers.OIDCCallback)
+			auth.POST("/oidc/exchange", limit("oauth"), handlers.ExchangeLoginCode)
+			auth.POST("/refresh", limit("refresh"), handlers.RefreshToken)
 			auth.POST("/logout", handlers.Logout)
-			auth.POST("/forgot-password", handlers.ForgotPassword)
-			auth.POST("/reset-password", handlers.ResetPassword)
+			auth.POST("/forgot-password", limit("forgot_password"), handlers.ForgotPassword)
+			auth.POST("/reset-password", limit("reset_password"), handlers.ResetPassword)
+			auth.POST("/change-password", limit("reset_password"), handlers.ChangeExpiredPassword)
+			auth.GET("/password-policy", handlers.GetPasswordPolicy)
+			auth.POST("/verify-email", limit("verify_email"), handlers.VerifyEmail)
+			auth.POST("/resend-verification", limit("verify_email"), handlers.ResendVerificationEmail)
+			auth.POST("/mfa/enroll", limit("mfa"), handlers.EnrollMFA)
+			auth.POST("/mfa/verify", limit("mfa"), handlers.VerifyMFA)
+			auth.POST("/passkey/options", limit("passkey"), handlers.GetPasskeyLoginOptions)
+			auth.POST("/passkey/login", limit("passkey"), handlers.PasskeyLogin)
 		}
 
 		// Protected routes
 		protected := v1.Group("/")
-		protected.Use(handlers.AuthMiddleware())
+		protected.Use(handlers.AuthMiddleware(), limit("api"))
 		{
 			// User routes
 			users := protected.Group("/users")
 			{
-				users.GET("/", handlers.GetAllUsers)
-				users.GET("/:id", handlers.GetUserByID)
-				users.PUT("/:id", handlers.UpdateUser)
-				users.DELETE("/:id", handlers.DeleteUser)
+				users.GET("/", handlers.RequirePermission(models.PermUsersRead), handlers.GetAllUsers)
+				users.POST("/", handlers.RequirePermission(models.PermUsersCreate), handlers.CreateUser)
+				users.GET("/:id", handlers.RequirePermission(models.PermUsersRead), handlers.GetUserByID)
+				users.PATCH("/:id", handlers.UpdateUser) // Authorized per field inside the handler
+				users.DELETE("/:id", handlers.RequirePermission(models.PermUsersDelete), handlers.DeleteUser)
+				users.POST("/:id/restore", handlers.RequirePermission(models.PermUsersDelete), handlers.RestoreUser)
+				users.DELETE("/:id/purge", handlers.RequirePermission(models.PermUsersPurge), handlers.PurgeUser)
+				users.GET("/:id/lockout", handlers.RequirePermission(models.PermUsersRead), handlers.GetUserLockout)
+				users.POST("/:id/unlock", handlers.RequirePermission(models.PermUsersUpdate), handlers.UnlockUser)
+				users.DELETE("/:id/mfa", handlers.RequirePermission(models.PermUsersUpdate), handlers.ResetUserMFA)
+
+				// Session management for administrators
+				users.GET("/:id/sessions", handlers.RequirePermission(models.PermSessionsManage), handlers.GetUserSessions)
+				users.DELETE("/:id/sessions/:sid", handlers.RequirePermission(models.PermSessionsManage), handlers.RevokeUserSession)
+				users.POST("/:id/sessions/revoke-all", handlers.RequirePermission(models.PermSessionsManage), handlers.RevokeAllUserSessions)
+			}
+
+			// Role and permission management routes
+			roles := protected.Group("/roles")
+			{
+				roles.GET("/", handlers.RequirePermission(models.PermRolesRead), handlers.GetAllRoles)
+				roles.POST("/", handlers.RequirePermission(models.PermRolesManage), handlers.CreateRole)
+				roles.PUT("/:name/permissions", handlers.RequirePermission(models.PermRolesManage), handlers.UpdateRolePermissions)
+				roles.PUT("/:name/mfa", handlers.RequirePermission(models.PermRolesManage), handlers.UpdateRoleMFA)
+				roles.DELETE("/:name", handlers.RequirePermission(models.PermRolesManage), handlers.DeleteRole)
 			}
+			protected.GET("/permissions", handlers.RequirePermission(models.PermRolesRead), handlers.GetAllPermissions)
 
 			// Me endpoint for getting current user info
 			protected.GET("/me", handlers.GetCurrentUser)
+
+			// Current user's own resources
+			me := protected.Group("/me")
+			{
+				me.GET("/sessions", handlers.GetMySessions)
+				me.DELETE("/sessions/:id", handlers.RevokeMySession)
+				me.POST("/sessions/revoke-others", handlers.RevokeMyOtherSessions)
+				me.POST("/sessions/revoke-all", handlers.RevokeAllMySessions)
+				me.POST("/email/verification", handlers.ResendMyVerificationEmail)
+				me.POST("/password", handlers.ChangeMyPassword)
+				me.GET("/identities", handlers.GetMyIdentities)
+				me.POST("/identities/google", handlers.LinkGoogleIdentity)
+				me.DELETE("/identities/:provider", handlers.UnlinkIdentity)
+				me.GET("/mfa", handlers.GetMyMFA)
+				me.POST("/mfa/totp", handlers.BeginMyTOTP)
+				me.POST("/mfa/totp/confirm", handlers.ConfirmMyTOTP)
+				me.DELETE("/mfa/totp", handlers.DisableMyTOTP)
+				me.POST("/mfa/recovery-codes", handlers.RegenerateMyRecoveryCodes)
+				me.GET("/passkeys", handlers.GetMyPasskeys)
+				me.POST("/passkeys/options", handlers.GetMyPasskeyOptions)
+				me.POST("/passkeys", handlers.RegisterMyPasskey)
+				me.PATCH("/passkeys/:id", handlers.RenameMyPasskey)
+				me.DELETE("/passkeys/:id", handlers.DeleteMyPasskey)
+			}
 		}
 	}
 
 	// Start server
-	log.Println("Server starting on :8080")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: cfg.Server.Addr, Handler: router}
+	go func() {
+		log.Printf("Server starting on %s", cfg.Server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, finish the requests in flight and deliver the mail they queued before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to finish requests: %v", err)
+	}
+	if err := handlers.CloseMail(shutdownCtx); err != nil {
+		log.Printf("Failed to deliver queued mail: %v", err)
+	}
+}
+
+// shutdownTimeout bounds how long the server waits for requests and queued mail when stopping
+const shutdownTimeout = 30 * time.Second
+
+// exposedHeaders are the response headers the SPA may read, including rate limit state
+var exposedHeaders = []string{
+	"Content-Length", "Link", "X-Total-Count",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After",
+}
+
+// rateLimiter returns a function building the middleware for a configured rate limit policy.
+// Policies missing from the configuration are disabled.
+func rateLimiter(cfg *config.Config) func(name string) gin.HandlerFunc {
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "sql" {
+		store = ratelimit.NewSQLStore(database.DB)
+	}
+
+	return func(name string) gin.HandlerFunc {
+		policy := cfg.RateLimit.Policies[name]
+		key := ratelimit.Keys[policy.Key]
+		if key == nil {
+			key = ratelimit.ByIP
+		}
+
+		return ratelimit.Middleware(store, ratelimit.Policy{
+			Name:  name,
+			Limit: ratelimit.Limit{Requests: policy.Requests, Per: policy.Per, Burst: policy.Burst},
+			Key:   key,
+		})
 	}
 }
@@ -8,12 +8,32 @@ import (
 type AuditAction string
 
 const (
-	ActionLogin         AuditAction = "login"
-	ActionLogout        AuditAction = "logout"
-	ActionRefresh       AuditAction = "refresh"
-	ActionPasswordReset AuditAction = "password_reset"
-	ActionRegister      AuditAction = "register"
-	ActionGoogleAuth    AuditAction = "google_auth"
+	ActionLogin          AuditAction = "login"
+	ActionLogout         AuditAction = "logout"
+	ActionRefresh        AuditAction = "refresh"
+	ActionPasswordReset  AuditAction = "password_reset"
+	ActionPasswordChange AuditAction = "password_change"
+	ActionRegister       AuditAction = "register"
+	ActionGoogleAuth     AuditAction = "google_auth"
+	ActionOIDCAuth       AuditAction = "oidc_auth"
+	ActionRoleUpdate     AuditAction = "role_update"
+	ActionUserCreate     AuditAction = "user_create"
+	ActionUserUpdate     AuditAction = "user_update"
+	ActionUserDelete     AuditAction = "user_delete"
+	ActionUserRestore    AuditAction = "user_restore"
+	ActionUserPurge      AuditAction = "user_purge"
+	ActionSessionRevoke  AuditAction = "session_revoke"
+	ActionTokenReuse     AuditAction = "refresh_token_reuse"
+	ActionIdentityLink   AuditAction = "identity_link"
+	ActionIdentityUnlink AuditAction = "identity_unlink"
+	ActionAccountLock    AuditAction = "account_lock"
+	ActionAccountUnlock  AuditAction = "account_unlock"
+	ActionMFAEnroll      AuditAction = "mfa_enroll"
+	ActionMFAVerify      AuditAction = "mfa_verify"
+	ActionMFADisable     AuditAction = "mfa_disable"
+	ActionPasskeyAdd     AuditAction = "passkey_add"
+	ActionPasskeyRemove  AuditAction = "passkey_remove"
+	ActionEmailVerify    AuditAction = "email_verify"
 )
 
 // AuthAudit represents an authentication event for auditing purposes
@@ -21,7 +41,7 @@ type AuthAudit struct {
 	ID        uint        `json:"id" gorm:"primaryKey"`
 	UserID    uint        `json:"user_id" gorm:"index"`
 	Action    AuditAction `json:"action" gorm:"not null"`
-	Success   bool        `json:"success" gorm:"default:true"`
+	Success   bool        `json:"success"`
 	IPAddress string      `json:"ip_address" gorm:"default:null"`
 	UserAgent string      `json:"user_agent" gorm:"default:null"`
 	DeviceID  string      `json:"device_id" gorm:"default:null"`
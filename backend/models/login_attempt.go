@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt counts recent failed logins for one account or client IP
+type LoginAttempt struct {
+	Subject       string    `json:"subject" gorm:"primaryKey"` // "account:<email>" or "ip:<address>"
+	Failures      int       `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time `json:"last_failure_at" gorm:"default:null"`
+	RetryAfter    time.Time `json:"retry_after" gorm:"default:null"`  // No attempts are checked before this instant (backoff)
+	LockedUntil   time.Time `json:"locked_until" gorm:"default:null"` // Set when the failure count reaches the lockout threshold
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
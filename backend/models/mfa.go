@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// TOTPFactor is a user's authenticator app; it only counts as a second factor once confirmed
+type TOTPFactor struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	Secret       string    `json:"-" gorm:"not null"`                // Shared secret sealed with secretbox
+	ConfirmedAt  time.Time `json:"confirmed_at" gorm:"default:null"` // Set when the user proved the app produces codes
+	LastUsedStep int64     `json:"-"`                                // Time step of the last accepted code, so codes are not replayed
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// RecoveryCode is a single-use code that stands in for the authenticator app
+type RecoveryCode struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	CodeHash  string    `json:"-" gorm:"not null"`
+	UsedAt    time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
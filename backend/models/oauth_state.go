@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuthState is a pending sign-in at an identity provider, consumed once by its callback
+type OAuthState struct {
+	ID           string    `json:"-" gorm:"primaryKey"` // SHA-256 of the state parameter
+	Provider     string    `json:"provider" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`            // PKCE verifier sent with the token request
+	Nonce        string    `json:"-" gorm:"not null"`            // Must come back in the ID token
+	RedirectURI  string    `json:"redirect_uri" gorm:"not null"` // SPA page the callback hands off to
+	ExpiresAt    time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// LoginCode is a one-time code the SPA exchanges for tokens after signing in at an identity provider
+type LoginCode struct {
+	ID        string    `json:"-" gorm:"primaryKey"` // SHA-256 of the code
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
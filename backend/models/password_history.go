@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordHistory records a password a user has had, so it cannot be reused
+type PasswordHistory struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Password  string    `json:"-" gorm:"not null"` // bcrypt hash, not returned in JSON
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
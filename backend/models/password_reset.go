@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetToken represents a single-use token issued for resetting a password
+type PasswordResetToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	TokenHash string    `json:"-" gorm:"not null;uniqueIndex"` // Hashed reset token, not returned in JSON
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+	UsedAt    time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
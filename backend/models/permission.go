@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// Permission represents a single action a role may be allowed to perform
+type Permission string
+
+const (
+	PermUsersRead   Permission = "users:read"
+	PermUsersCreate Permission = "users:create"
+	PermUsersUpdate Permission = "users:update"
+	PermUsersDelete Permission = "users:delete"
+	PermUsersPurge  Permission = "users:purge"
+	PermRolesRead   Permission = "roles:read"
+	PermRolesManage Permission = "roles:manage"
+
+	PermSessionsManage Permission = "sessions:manage"
+)
+
+// AllPermissions lists every permission known to the system
+var AllPermissions = []Permission{
+	PermUsersRead,
+	PermUsersCreate,
+	PermUsersUpdate,
+	PermUsersDelete,
+	PermUsersPurge,
+	PermRolesRead,
+	PermRolesManage,
+	PermSessionsManage,
+}
+
+// IsValid reports whether the permission is known to the system
+func (p Permission) IsValid() bool {
+	for _, known := range AllPermissions {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRolePermissions defines the built-in roles and the permissions they are seeded with
+var DefaultRolePermissions = map[Role][]Permission{
+	RoleAdmin:     AllPermissions,
+	RoleUser:      {},
+	RoleInspector: {PermUsersRead, PermRolesRead},
+}
+
+// RoleDefinition represents a role that can be assigned to users
+type RoleDefinition struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	Name        Role             `json:"name" gorm:"unique;not null"`
+	Description string           `json:"description"`
+	BuiltIn     bool             `json:"built_in"`
+	RequireMFA  bool             `json:"require_mfa"` // Members must sign in with a second factor
+	Permissions []RolePermission `json:"permissions" gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt   time.Time        `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time        `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// RolePermission grants a permission to a role
+type RolePermission struct {
+	ID               uint       `json:"-" gorm:"primaryKey"`
+	RoleDefinitionID uint       `json:"-" gorm:"not null;uniqueIndex:idx_role_permission"`
+	Permission       Permission `json:"permission" gorm:"not null;uniqueIndex:idx_role_permission"`
+}
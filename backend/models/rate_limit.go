@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimitBucket is the token bucket of one client under one rate limit policy
+type RateLimitBucket struct {
+	ID        string    `json:"id" gorm:"primaryKey"` // "<policy>:<client key>"
+	Tokens    float64   `json:"tokens" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`    // When Tokens was last computed
+	FullAt    time.Time `json:"full_at" gorm:"not null;index"` // The bucket can be deleted once it has refilled
+}
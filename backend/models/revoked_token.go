@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken records an access token or single-use ticket that must be rejected before it expires
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"` // Entry can be dropped once the token itself has expired
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
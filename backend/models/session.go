@@ -6,14 +6,19 @@ import (
 
 // Session represents a user's login session with refresh token
 type Session struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	UserID       uint      `json:"user_id" gorm:"not null;index"`
-	RefreshToken string    `json:"-" gorm:"not null"` // Hashed refresh token, not returned in JSON
-	DeviceID     string    `json:"device_id" gorm:"default:null"`
-	UserAgent    string    `json:"user_agent" gorm:"default:null"`
-	IPAddress    string    `json:"ip_address" gorm:"default:null"`
-	ExpiresAt    time.Time `json:"expires_at" gorm:"not null"`
-	RevokedAt    time.Time `json:"revoked_at" gorm:"default:null"`
-	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	RefreshToken  string    `json:"-" gorm:"not null"`             // Hashed refresh token, not returned in JSON
+	FamilyID      string    `json:"family_id" gorm:"index"`        // Shared by every session rotated from the same login
+	ParentID      uint      `json:"parent_id" gorm:"default:null"` // Session whose refresh token was rotated into this one
+	AccessTokenID string    `json:"-" gorm:"default:null"`         // jti of the latest access token issued for this session
+	DeviceID      string    `json:"device_id" gorm:"default:null"`
+	UserAgent     string    `json:"user_agent" gorm:"default:null"`
+	IPAddress     string    `json:"ip_address" gorm:"default:null"`
+	AuthMethods   string    `json:"auth_methods" gorm:"default:null"` // Comma-separated amr values of the sign-in, kept across refreshes
+	ExpiresAt     time.Time `json:"expires_at" gorm:"not null"`
+	RevokedAt     time.Time `json:"revoked_at" gorm:"default:null"`
+	RotatedAt     time.Time `json:"-" gorm:"default:null"` // Set when the refresh token was exchanged for a new one; presenting it again is a replay
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 }
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is an asymmetric key used to sign access tokens, identified by its kid
+type SigningKey struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	KID        string    `json:"kid" gorm:"column:kid;not null;uniqueIndex"`
+	Algorithm  string    `json:"algorithm" gorm:"not null"`
+	PrivateKey string    `json:"-" gorm:"not null"`              // Encrypted PKCS #8 private key, not returned in JSON
+	RetiredAt  time.Time `json:"retired_at" gorm:"default:null"` // Set when a newer key takes over signing
+	ExpiresAt  time.Time `json:"expires_at" gorm:"default:null"` // Retired keys stop verifying tokens after this
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Role represents a user role in the system
@@ -26,12 +28,15 @@ func (r *Roles) Scan(value interface{}) error {
 		return nil
 	}
 
-	bytes, ok := value.([]byte)
-	if !ok {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		// SQLite returns column defaults as text
+		return json.Unmarshal([]byte(v), r)
+	default:
 		return errors.New("failed to scan Roles")
 	}
-
-	return json.Unmarshal(bytes, r)
 }
 
 // Value implements the driver.Valuer interface for Roles
@@ -45,18 +50,22 @@ func (r Roles) Value() (driver.Value, error) {
 
 // User represents a user in the system
 type User struct {
-	ID               uint      `json:"id" gorm:"primaryKey"`
-	Email            string    `json:"email" gorm:"unique;not null"`
-	Password         string    `json:"-" gorm:"default:null"` // Password not returned in JSON, can be null for Google-only accounts
-	GoogleID         string    `json:"google_id" gorm:"unique;index"`
-	GoogleSub        string    `json:"google_sub" gorm:"unique;index"` // Subject identifier from Google
-	FirstName        string    `json:"first_name"`
-	LastName         string    `json:"last_name"`
-	HasLocalPassword bool      `json:"has_local_password" gorm:"default:false"`
-	Roles            Roles     `json:"roles" gorm:"type:json;default:'[\"user\"]'"`
-	IsActive         bool      `json:"is_active" gorm:"default:true"`
-	IsAdmin          bool      `json:"is_admin" gorm:"default:false"`
-	LastLogin        time.Time `json:"last_login" gorm:"default:null"`
-	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt        time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Email            string         `json:"email" gorm:"unique;not null"`
+	Password         string         `json:"-" gorm:"default:null"` // Password not returned in JSON, can be null for Google-only accounts
+	GoogleID         string         `json:"google_id" gorm:"unique;index;default:null"`
+	FirstName        string         `json:"first_name"`
+	LastName         string         `json:"last_name"`
+	HasLocalPassword bool           `json:"has_local_password" gorm:"default:false"`
+	EmailVerifiedAt  time.Time      `json:"email_verified_at" gorm:"default:null"` // When the user proved they own the email; zero until then
+	PasswordSetAt    time.Time      `json:"password_set_at" gorm:"default:null"`   // When the local password was last set; passwords expire from here
+	Roles            Roles          `json:"roles" gorm:"type:json;default:'[\"user\"]'"`
+	IsActive         bool           `json:"is_active"`
+	IsAdmin          bool           `json:"is_admin" gorm:"default:false"`
+	LastLogin        time.Time      `json:"last_login" gorm:"default:null"`
+	TokensValidAfter time.Time      `json:"-" gorm:"default:null"` // Access tokens issued before this instant are rejected
+	CreatedAt        time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt        gorm.DeletedAt `json:"deleted_at" gorm:"index"` // Set when the account is soft-deleted
+	Identities       []UserIdentity `json:"identities,omitempty"`    // Linked external accounts, loaded on demand
 }
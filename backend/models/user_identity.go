@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_identity_user_provider"`
+	Provider   string    `json:"provider" gorm:"not null;uniqueIndex:idx_identity_subject;uniqueIndex:idx_identity_user_provider"`
+	Subject    string    `json:"subject" gorm:"not null;uniqueIndex:idx_identity_subject"` // Provider's stable identifier for the account
+	Email      string    `json:"email" gorm:"default:null"`                                // Email the provider asserted when the identity was linked
+	LastUsedAt time.Time `json:"last_used_at" gorm:"default:null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// ProviderGoogle is the provider name of identities linked through Google Sign-In
+const ProviderGoogle = "google"
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// WebAuthnCredential is a passkey a user registered to sign in without a password
+type WebAuthnCredential struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	CredentialID   string    `json:"credential_id" gorm:"not null;uniqueIndex"` // base64url credential ID chosen by the authenticator
+	PublicKey      []byte    `json:"-" gorm:"not null"`                         // COSE_Key
+	SignCount      uint32    `json:"-"`                                         // Signature counter, used to detect cloned authenticators
+	AAGUID         string    `json:"aaguid" gorm:"default:null"`                // Authenticator model, hex
+	Transports     string    `json:"transports" gorm:"default:null"`            // Comma-separated hints such as internal or hybrid
+	BackupEligible bool      `json:"backup_eligible"`                           // Synced passkey rather than one bound to a device
+	BackedUp       bool      `json:"backed_up"`
+	Name           string    `json:"name" gorm:"not null"`
+	LastUsedAt     time.Time `json:"last_used_at" gorm:"default:null"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,150 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// falsePositiveRate is the share of unlisted passwords a breached list wrongly reports as breached
+const falsePositiveRate = 0.001
+
+// bundled holds common passwords from public breach corpora, one per line
+//
+//go:embed breached.txt
+var bundled string
+
+// BreachedList reports whether passwords appear in a list of breached passwords.
+// Entries are kept as SHA-1 digests in a bloom filter, so large lists fit in little memory
+// at the cost of rejecting about one in a thousand unlisted passwords.
+type BreachedList struct {
+	bits   []uint64
+	size   uint64 // Number of bits
+	hashes int    // Bit positions set per entry
+}
+
+// DefaultBreachedList returns the bundled list
+func DefaultBreachedList() *BreachedList {
+	return newBreachedList(0)
+}
+
+// LoadBreachedList returns the bundled list extended with the entries of the file at path.
+// Each line holds a password or its hex SHA-1 hash; a ":count" suffix after a hash, as in
+// Have I Been Pwned downloads, is ignored.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	if path == "" {
+		return DefaultBreachedList(), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	// Count the entries first so the filter is sized for them
+	entries := countLines(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+
+	list := newBreachedList(entries)
+	if err := list.addLines(f); err != nil {
+		return nil, fmt.Errorf("read breached password list %s: %w", path, err)
+	}
+
+	return list, nil
+}
+
+// newBreachedList returns a list holding the bundled entries, sized for extra entries more
+func newBreachedList(extra int) *BreachedList {
+	n := float64(countLines(strings.NewReader(bundled)) + extra)
+	size := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	list := &BreachedList{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: max(1, int(math.Round(float64(size)/n*math.Ln2))),
+	}
+
+	list.addLines(strings.NewReader(bundled)) // Reading from a string cannot fail
+	return list
+}
+
+// Contains reports whether the password, or its lowercase form, is on the list
+func (b *BreachedList) Contains(password string) bool {
+	if b.contains(sha1.Sum([]byte(password))) {
+		return true
+	}
+	lower := strings.ToLower(password)
+	return lower != password && b.contains(sha1.Sum([]byte(lower)))
+}
+
+// addLines adds every non-empty line of r to the list
+func (b *BreachedList) addLines(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		b.add(entryDigest(line))
+	}
+	return scanner.Err()
+}
+
+// entryDigest returns the SHA-1 digest of a list entry, which is either a hash or a plain password
+func entryDigest(line string) [sha1.Size]byte {
+	hash, _, _ := strings.Cut(line, ":")
+	if len(hash) == 2*sha1.Size {
+		var digest [sha1.Size]byte
+		if _, err := hex.Decode(digest[:], []byte(hash)); err == nil {
+			return digest
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// add sets the bits of a digest
+func (b *BreachedList) add(digest [sha1.Size]byte) {
+	h1, h2 := splitDigest(digest)
+	for i := range b.hashes {
+		bit := (h1 + uint64(i)*h2) % b.size
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// contains reports whether all bits of a digest are set
+func (b *BreachedList) contains(digest [sha1.Size]byte) bool {
+	h1, h2 := splitDigest(digest)
+	for i := range b.hashes {
+		bit := (h1 + uint64(i)*h2) % b.size
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitDigest derives the two hashes combined into every bit position (Kirsch-Mitzenmacher)
+func splitDigest(digest [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16]) | 1
+}
+
+// countLines counts the non-empty lines of r
+func countLines(r io.Reader) int {
+	n := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimRight(scanner.Text(), "\r") != "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,88 @@
+// Package passwordpolicy checks new passwords against configurable rules and a list of known breached passwords.
+package passwordpolicy
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest password bcrypt accepts
+const MaxBytes = 72
+
+// Violation codes reported by Check
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeMissingUppercase = "missing_uppercase"
+	CodeMissingLowercase = "missing_lowercase"
+	CodeMissingDigit     = "missing_digit"
+	CodeMissingSymbol    = "missing_symbol"
+	CodeBreached         = "breached"
+	CodeReused           = "reused" // Reported by callers that keep a password history
+)
+
+// Policy holds the rules a new password must satisfy
+type Policy struct {
+	MinLength        int // Characters
+	MaxLength        int // Characters, and never more than MaxBytes bytes
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool          // Anything that is not a letter or a digit, spaces included
+	Breached         *BreachedList // Nil skips the breached password check
+}
+
+// Violation describes one rule a password breaks
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Check returns every rule the password breaks, or nil when it satisfies the policy
+func (p *Policy) Check(password string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{CodeTooShort,
+			fmt.Sprintf("Password must be at least %d characters", p.MinLength)})
+	}
+	if length > p.MaxLength || len(password) > MaxBytes {
+		violations = append(violations, Violation{CodeTooLong,
+			fmt.Sprintf("Password must be at most %d characters", p.MaxLength)})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, Violation{CodeMissingUppercase, "Password must contain an uppercase letter"})
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, Violation{CodeMissingLowercase, "Password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, Violation{CodeMissingDigit, "Password must contain a digit"})
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, Violation{CodeMissingSymbol, "Password must contain a symbol"})
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{CodeBreached,
+			"This password has appeared in a data breach and cannot be used"})
+	}
+
+	return violations
+}
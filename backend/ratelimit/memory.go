@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often stores drop buckets that have refilled completely
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in process memory. Limits are per process and reset on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	fullAt  time.Time // A full bucket is the same as no bucket, so it can be dropped after this
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take removes a token from the bucket identified by key
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.capacity(), updated: now}
+		s.buckets[key] = b
+	}
+
+	var result Result
+	b.tokens, b.fullAt, result = take(b.tokens, b.updated, now, limit)
+	b.updated = now
+	return result, nil
+}
+
+// sweep drops full buckets so idle clients do not hold memory
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !b.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc identifies the client a request is counted against
+type KeyFunc func(c *gin.Context) string
+
+// ByIP counts requests per client IP
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser counts requests per authenticated user, falling back to the client IP.
+// It must run after the authentication middleware.
+func ByUser(c *gin.Context) string {
+	if userID := c.GetUint("userID"); userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return ByIP(c)
+}
+
+// ByDevice counts requests per X-Device-ID header, falling back to the client IP.
+// Clients choose their device ID, so pair it with an IP-keyed limit where abuse matters.
+func ByDevice(c *gin.Context) string {
+	if deviceID := c.GetHeader("X-Device-ID"); deviceID != "" {
+		return "device:" + deviceID
+	}
+	return ByIP(c)
+}
+
+// Keys maps key names used in configuration to key functions
+var Keys = map[string]KeyFunc{
+	"ip":     ByIP,
+	"user":   ByUser,
+	"device": ByDevice,
+}
+
+// Policy is a named limit applied to requests grouped by Key
+type Policy struct {
+	Name  string // Separates the buckets of different policies
+	Limit Limit
+	Key   KeyFunc
+}
+
+// Middleware enforces policy, answering 429 with Retry-After once a client's bucket is empty.
+// Every response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// A policy without requests is disabled; store failures let the request through.
+func Middleware(store Store, policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.Limit.Requests <= 0 {
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(c.Request.Context(), policy.Name+":"+policy.Key(c), policy.Limit)
+		if err != nil {
+			log.Printf("ratelimit: %s: %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", policy.Limit.Requests,
+			ceilSeconds(policy.Limit.Per.Seconds()), result.Limit))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(result.RetryAfter.Seconds()), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests. Please try again later."})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Middleware(NewMemoryStore(), Policy{
+		Name:  "test",
+		Limit: Limit{Requests: 2, Per: time.Minute},
+		Key:   ByIP,
+	}))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		wantStatus     int
+		wantRemaining  string
+		wantRetryAfter string // Empty when the header must be absent
+	}{
+		{http.StatusNoContent, "1", ""},
+		{http.StatusNoContent, "0", ""},
+		{http.StatusTooManyRequests, "0", "30"}, // One token every 30 seconds
+	}
+
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want 2", i+1, got)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %q", i+1, got, tt.wantRemaining)
+		}
+		if reset, err := strconv.Atoi(w.Header().Get("RateLimit-Reset")); err != nil || reset < 1 || reset > 60 {
+			t.Errorf("request %d: RateLimit-Reset = %q", i+1, w.Header().Get("RateLimit-Reset"))
+		}
+		if got := w.Header().Get("RateLimit-Policy"); got != "2;w=60;burst=2" {
+			t.Errorf("request %d: RateLimit-Policy = %q", i+1, got)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+			t.Errorf("request %d: Retry-After = %q, want %q", i+1, got, tt.wantRetryAfter)
+		}
+	}
+}
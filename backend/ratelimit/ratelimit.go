@@ -0,0 +1,71 @@
+// Package ratelimit limits request rates with token buckets kept in a pluggable store.
+//
+// Each bucket holds up to Burst tokens and refills at Requests per Per. A request takes one token
+// and is rejected when none is left.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket
+type Limit struct {
+	Requests int           // Tokens added per Per
+	Per      time.Duration // Refill period
+	Burst    int           // Bucket capacity; defaults to Requests
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int           // Bucket capacity
+	Remaining  int           // Whole tokens left after this request
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next token is available, when the request was rejected
+}
+
+// Store keeps bucket state
+type Store interface {
+	// Take removes a token from the bucket identified by key
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// capacity returns the number of tokens a full bucket holds
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rate returns the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// take applies a request at now to a bucket that held tokens at updated.
+// It returns the tokens left and when the bucket will be full again.
+func take(tokens float64, updated, now time.Time, limit Limit) (float64, time.Time, Result) {
+	capacity, rate := limit.capacity(), limit.rate()
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(capacity, tokens+elapsed*rate)
+	}
+
+	result := Result{Limit: int(capacity)}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+
+	result.Remaining = int(tokens)
+	result.Reset = seconds((capacity - tokens) / rate)
+	return tokens, now.Add(result.Reset), result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
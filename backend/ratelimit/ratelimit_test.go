@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// approx reports whether two durations are within a millisecond, absorbing float rounding in take
+func approx(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -time.Millisecond && diff < time.Millisecond
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Requests: 10, Per: 10 * time.Second, Burst: 5} // One token per second, up to five
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		limit      Limit
+		tokens     float64       // Tokens in the bucket when it was last updated
+		elapsed    time.Duration // Since the last update
+		wantTokens float64
+		want       Result
+	}{
+		{
+			name:       "full bucket",
+			limit:      limit,
+			tokens:     5,
+			wantTokens: 4,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 4, Reset: time.Second},
+		},
+		{
+			name:       "last token",
+			limit:      limit,
+			tokens:     1,
+			wantTokens: 0,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 0, Reset: 5 * time.Second},
+		},
+		{
+			name:       "empty bucket",
+			limit:      limit,
+			tokens:     0,
+			wantTokens: 0,
+			want:       Result{Limit: 5, Reset: 5 * time.Second, RetryAfter: time.Second},
+		},
+		{
+			name:       "partly refilled token",
+			limit:      limit,
+			tokens:     0,
+			elapsed:    500 * time.Millisecond,
+			wantTokens: 0.5,
+			want:       Result{Limit: 5, Reset: 4500 * time.Millisecond, RetryAfter: 500 * time.Millisecond},
+		},
+		{
+			name:       "refilled since the last request",
+			limit:      limit,
+			tokens:     0,
+			elapsed:    3 * time.Second,
+			wantTokens: 2,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 2, Reset: 3 * time.Second},
+		},
+		{
+			name:       "refill stops at the burst",
+			limit:      limit,
+			tokens:     2,
+			elapsed:    time.Hour,
+			wantTokens: 4,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 4, Reset: time.Second},
+		},
+		{
+			name:       "burst defaults to requests",
+			limit:      Limit{Requests: 3, Per: time.Minute},
+			tokens:     3,
+			wantTokens: 2,
+			want:       Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 20 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, fullAt, result := take(tt.tokens, now.Add(-tt.elapsed), now, tt.limit)
+
+			if diff := tokens - tt.wantTokens; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			if result.Allowed != tt.want.Allowed || result.Limit != tt.want.Limit || result.Remaining != tt.want.Remaining {
+				t.Errorf("result = %+v, want %+v", result, tt.want)
+			}
+			if !approx(result.Reset, tt.want.Reset) || !approx(result.RetryAfter, tt.want.RetryAfter) {
+				t.Errorf("reset = %v, retry after = %v, want %v and %v",
+					result.Reset, result.RetryAfter, tt.want.Reset, tt.want.RetryAfter)
+			}
+			if !approx(fullAt.Sub(now), tt.want.Reset) {
+				t.Errorf("full in %v, want %v", fullAt.Sub(now), tt.want.Reset)
+			}
+		})
+	}
+}
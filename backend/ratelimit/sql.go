@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"mis-system/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLStore keeps buckets in the rate_limit_buckets table so every process shares the same limits
+type SQLStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewSQLStore returns a store backed by db
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Take removes a token from the bucket identified by key
+func (s *SQLStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	if err := s.sweep(ctx, now); err != nil {
+		return Result{}, err
+	}
+
+	var result Result
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Writing first takes the database write lock, so concurrent requests update the bucket one at a time
+		b := models.RateLimitBucket{ID: key, Tokens: limit.capacity(), UpdatedAt: now, FullAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&b).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&b, "id = ?", key).Error; err != nil {
+			return err
+		}
+
+		b.Tokens, b.FullAt, result = take(b.Tokens, b.UpdatedAt, now, limit)
+		b.UpdatedAt = now
+		return tx.Save(&b).Error
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+// sweep deletes full buckets at most once per sweepInterval
+func (s *SQLStore) sweep(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return nil
+	}
+	s.lastSweep = now
+
+	return s.db.WithContext(ctx).Where("full_at <= ?", now).Delete(&models.RateLimitBucket{}).Error
+}
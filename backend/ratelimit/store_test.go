@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"mis-system/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ratelimit.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.RateLimitBucket{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) (Store, Store) // Two stores that must share buckets, e.g. in two processes
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) (Store, Store) {
+				s := NewMemoryStore()
+				return s, s
+			},
+		},
+		{
+			name: "sql",
+			store: func(t *testing.T) (Store, Store) {
+				db := newTestDB(t)
+				return NewSQLStore(db), NewSQLStore(db)
+			},
+		},
+	}
+
+	ctx := context.Background()
+	limit := Limit{Requests: 1, Per: 100 * time.Millisecond, Burst: 2}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			store, other := tt.store(t)
+
+			// The burst is used up, across stores sharing the buckets
+			for i, s := range []Store{store, other} {
+				result, err := s.Take(ctx, "policy:client", limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.Allowed || result.Limit != 2 || result.Remaining != 1-i {
+					t.Fatalf("request %d: result = %+v", i+1, result)
+				}
+			}
+			result, err := store.Take(ctx, "policy:client", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+				t.Fatalf("request past the burst: result = %+v", result)
+			}
+
+			// Other clients have their own bucket
+			if result, err := store.Take(ctx, "policy:someone-else", limit); err != nil || !result.Allowed {
+				t.Errorf("other client: result = %+v, err = %v", result, err)
+			}
+
+			// The bucket refills over time
+			time.Sleep(result.RetryAfter + 20*time.Millisecond)
+			if result, err := other.Take(ctx, "policy:client", limit); err != nil || !result.Allowed {
+				t.Errorf("after refilling: result = %+v, err = %v", result, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) accepted for credentials, in order of preference
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Algorithms lists the accepted COSE algorithms
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9052)
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // EC2 and OKP curve; the RSA modulus shares the label
+	coseX   = -2 // EC2 x coordinate and OKP public key; the RSA exponent shares the label
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+var (
+	errUnsupportedKey = errors.New("webauthn: unsupported credential public key")
+	errSignature      = errors.New("webauthn: invalid signature")
+)
+
+// PublicKey is a credential public key together with the algorithm it signs with
+type PublicKey struct {
+	Alg int64
+	Key crypto.PublicKey
+}
+
+// ParsePublicKey decodes a COSE_Key as stored for a credential
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	item, _, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := item.(map[any]any)
+	if !ok {
+		return nil, errUnsupportedKey
+	}
+
+	kty, _ := params[int64(coseKty)].(int64)
+	alg, _ := params[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errUnsupportedKey
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errUnsupportedKey
+		}
+		return &PublicKey{Alg: alg, Key: key}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := params[int64(coseCrv)].(int64)
+		x, _ := params[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errUnsupportedKey
+		}
+		return &PublicKey{Alg: alg, Key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := params[int64(coseCrv)].([]byte)
+		e, _ := params[int64(coseX)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errUnsupportedKey
+		}
+		exponent := new(big.Int).SetBytes(e)
+		return &PublicKey{Alg: alg, Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	}
+
+	return nil, errUnsupportedKey
+}
+
+// Verify checks a signature over data made with the credential's private key
+func (k *PublicKey) Verify(data, signature []byte) error {
+	digest := sha256.Sum256(data)
+
+	var ok bool
+	switch key := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return errSignature
+	}
+
+	return nil
+}
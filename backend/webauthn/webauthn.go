@@ -0,0 +1,377 @@
+// Package webauthn implements the relying party side of WebAuthn (passkeys): it builds the options passed to
+// navigator.credentials or the Android Credential Manager and verifies the credentials they return.
+//
+// Attestation is not requested, so registration trusts the authenticator the signed-in user presents.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+)
+
+var (
+	ErrInvalidResponse = errors.New("webauthn: invalid authenticator response")
+	ErrChallenge       = errors.New("webauthn: challenge mismatch")
+	ErrOrigin          = errors.New("webauthn: origin not allowed")
+	ErrRPID            = errors.New("webauthn: relying party id mismatch")
+	ErrUserPresence    = errors.New("webauthn: user was not present")
+	ErrSignCount       = errors.New("webauthn: signature counter went backwards")
+)
+
+// Base64URL is binary data encoded as unpadded base64url in JSON, as WebAuthn's JSON forms use
+type Base64URL []byte
+
+// MarshalJSON encodes the bytes as unpadded base64url
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url with or without padding
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// String returns the unpadded base64url form
+func (b Base64URL) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// RelyingParty verifies ceremonies for one site
+type RelyingParty struct {
+	ID      string        // Domain credentials are scoped to, e.g. example.com
+	Name    string        // Shown by the authenticator
+	Origins []string      // Web origins and android:apk-key-hash:... origins allowed to use the credentials
+	Timeout time.Duration // How long the client lets the user respond
+}
+
+// User identifies the account a credential is registered for
+type User struct {
+	ID          []byte // Opaque handle, at most 64 bytes and free of personal data
+	Name        string
+	DisplayName string
+}
+
+// CredentialDescriptor refers to an existing credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// CreationOptions are the options for navigator.credentials.create, in their JSON form
+type CreationOptions struct {
+	Challenge Base64URL `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Base64URL `json:"id"`
+		Name        string    `json:"name"`
+		DisplayName string    `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout          int64                  `json:"timeout"` // Milliseconds
+	Exclude          []CredentialDescriptor `json:"excludeCredentials"`
+	Selection        struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// CredentialParameter names an accepted credential type and algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// RequestOptions are the options for navigator.credentials.get, in their JSON form
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout"` // Milliseconds
+	RPID             string                 `json:"rpId"`
+	Allow            []CredentialDescriptor `json:"allowCredentials"` // Empty for discoverable credentials
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the credential returned by navigator.credentials.create, in its JSON form
+type RegistrationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential returned by navigator.credentials.get, in its JSON form
+type AssertionResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a newly registered credential
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key, parsed with ParsePublicKey
+	SignCount      uint32
+	AAGUID         []byte // Authenticator model, all zero when not disclosed
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool // A synced passkey rather than one bound to a single device
+	BackedUp       bool
+}
+
+// Assertion is the outcome of a verified sign-in
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool // The authenticator checked a PIN or biometric, making the passkey a second factor in itself
+	BackedUp     bool
+}
+
+// clientData is the part of clientDataJSON the relying party checks
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticatorData is the parsed authenticator data (WebAuthn §6.1)
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// CreationOptions returns the options for registering a credential for user.
+// Credentials in exclude are not registered again on the same authenticator.
+func (rp *RelyingParty) CreationOptions(user User, challenge []byte, exclude []CredentialDescriptor) *CreationOptions {
+	options := &CreationOptions{
+		Challenge:   challenge,
+		Timeout:     rp.Timeout.Milliseconds(),
+		Exclude:     exclude,
+		Attestation: "none",
+	}
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	options.User.ID = user.ID
+	options.User.Name = user.Name
+	options.User.DisplayName = user.DisplayName
+	for _, alg := range Algorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	options.Selection.ResidentKey = "preferred"
+	options.Selection.UserVerification = "preferred"
+	if options.Exclude == nil {
+		options.Exclude = []CredentialDescriptor{}
+	}
+
+	return options
+}
+
+// RequestOptions returns the options for signing in; an empty allow list lets the user pick a discoverable credential
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		Allow:            allow,
+		UserVerification: "preferred",
+	}
+}
+
+// VerifyRegistration checks a new credential against the challenge the options were built with
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge []byte) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	attestation, ok := item.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+	raw, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	data, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(data); err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttestedData == 0 || !bytes.Equal(data.credentialID, resp.RawID) {
+		return nil, ErrInvalidResponse
+	}
+	if _, err := ParsePublicKey(data.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             data.credentialID,
+		PublicKey:      data.publicKey,
+		SignCount:      data.signCount,
+		AAGUID:         data.aaguid,
+		Transports:     resp.Response.Transports,
+		UserVerified:   data.flags&flagUserVerified != 0,
+		BackupEligible: data.flags&flagBackupEligible != 0,
+		BackedUp:       data.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion checks a sign-in made with a stored credential against the challenge the options were built with.
+// signCount is the counter stored for the credential; a counter that does not increase suggests a cloned authenticator.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge []byte, key *PublicKey, signCount uint32) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	data, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(data); err != nil {
+		return nil, err
+	}
+
+	// The signature covers the authenticator data followed by the hash of the client data
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(slices.Clone([]byte(resp.Response.AuthenticatorData)), clientDataHash[:]...)
+	if err := key.Verify(signed, resp.Response.Signature); err != nil {
+		return nil, err
+	}
+
+	// Authenticators without a counter always report zero
+	if (data.signCount != 0 || signCount != 0) && data.signCount <= signCount {
+		return nil, ErrSignCount
+	}
+
+	return &Assertion{
+		SignCount:    data.signCount,
+		UserVerified: data.flags&flagUserVerified != 0,
+		BackedUp:     data.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// verifyClientData checks the ceremony type, challenge and origin the client signed over
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil || data.Type != ceremony {
+		return ErrInvalidResponse
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || len(challenge) == 0 || !bytes.Equal(got, challenge) {
+		return ErrChallenge
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return ErrOrigin
+	}
+
+	return nil
+}
+
+// verifyAuthenticatorData checks the credential is scoped to this relying party and the user was present
+func (rp *RelyingParty) verifyAuthenticatorData(data *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return ErrRPID
+	}
+	if data.flags&flagUserPresent == 0 {
+		return ErrUserPresence
+	}
+
+	return nil
+}
+
+// parseAuthenticatorData splits authenticator data into its fields, including attested credential data when present
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrInvalidResponse
+	}
+
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagAttestedData == 0 {
+		return data, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, ErrInvalidResponse
+	}
+	data.aaguid = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return nil, ErrInvalidResponse
+	}
+	data.credentialID, rest = rest[:idLength], rest[idLength:]
+
+	// The public key is a single CBOR item; any extension outputs follow it
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	data.publicKey = rest[:len(rest)-len(extensions)]
+
+	return data, nil
+}
@@ -0,0 +1,371 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://app.example.com"
+)
+
+var testChallenge = []byte("0123456789abcdef0123456789abcdef")
+
+func testRelyingParty() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Name: "Example", Origins: []string{testOrigin}, Timeout: time.Minute}
+}
+
+// cborHead encodes the initial byte and argument of a CBOR data item
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(1, uint64(-1-n))
+	}
+	return cborHead(0, uint64(n))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, uint64(len(b))), b...) }
+
+func cborText(s string) []byte { return append(cborHead(3, uint64(len(s))), s...) }
+
+// cborMap encodes alternating, already encoded keys and values
+func cborMap(pairs ...[]byte) []byte {
+	out := cborHead(5, uint64(len(pairs)/2))
+	for _, item := range pairs {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// testAuthenticator is an ES256 authenticator holding one credential. Its fields may be changed between
+// ceremonies to produce the responses of a misbehaving or malicious client.
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+	flags     byte
+	rpID      string // Hashed into the authenticator data
+	origin    string // Reported in the client data
+	ceremony  string // Client data type; empty for the one matching the ceremony
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &testAuthenticator{
+		key:    key,
+		id:     id,
+		flags:  flagUserPresent | flagUserVerified,
+		rpID:   testRPID,
+		origin: testOrigin,
+	}
+}
+
+// coseKey returns the credential public key as a COSE_Key
+func (a *testAuthenticator) coseKey() []byte {
+	x := a.key.PublicKey.X.FillBytes(make([]byte, 32))
+	y := a.key.PublicKey.Y.FillBytes(make([]byte, 32))
+	return cborMap(
+		cborInt(coseKty), cborInt(ktyEC2),
+		cborInt(coseAlg), cborInt(AlgES256),
+		cborInt(coseCrv), cborInt(crvP256),
+		cborInt(coseX), cborBytes(x),
+		cborInt(coseY), cborBytes(y),
+	)
+}
+
+// authenticatorData builds authenticator data, with the attested credential when attested is set
+func (a *testAuthenticator) authenticatorData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedData
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID not disclosed
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *testAuthenticator) clientDataJSON(ceremony string, challenge []byte) []byte {
+	if a.ceremony != "" {
+		ceremony = a.ceremony
+	}
+	data, _ := json.Marshal(clientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	return data
+}
+
+// register answers navigator.credentials.create
+func (a *testAuthenticator) register(challenge []byte) *RegistrationResponse {
+	resp := &RegistrationResponse{ID: base64.RawURLEncoding.EncodeToString(a.id), RawID: a.id, Type: "public-key"}
+	resp.Response.ClientDataJSON = a.clientDataJSON("webauthn.create", challenge)
+	resp.Response.AttestationObject = cborMap(
+		cborText("fmt"), cborText("none"),
+		cborText("attStmt"), cborMap(),
+		cborText("authData"), cborBytes(a.authenticatorData(true)),
+	)
+	resp.Response.Transports = []string{"internal"}
+	return resp
+}
+
+// assert answers navigator.credentials.get, advancing the signature counter first
+func (a *testAuthenticator) assert(t *testing.T, challenge []byte) *AssertionResponse {
+	t.Helper()
+
+	a.signCount++
+	resp := &AssertionResponse{ID: base64.RawURLEncoding.EncodeToString(a.id), RawID: a.id, Type: "public-key"}
+	resp.Response.ClientDataJSON = a.clientDataJSON("webauthn.get", challenge)
+	resp.Response.AuthenticatorData = a.authenticatorData(false)
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	digest := sha256.Sum256(append(bytes.Clone(resp.Response.AuthenticatorData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Response.Signature = signature
+	return resp
+}
+
+func TestRegistrationAndAssertionRoundTrip(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newTestAuthenticator(t)
+	authenticator.flags |= flagBackupEligible | flagBackedUp
+
+	credential, err := rp.VerifyRegistration(authenticator.register(testChallenge), testChallenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	if !bytes.Equal(credential.ID, authenticator.id) || !credential.UserVerified ||
+		!credential.BackupEligible || !credential.BackedUp || len(credential.AAGUID) != 16 {
+		t.Errorf("credential = %+v", credential)
+	}
+
+	key, err := ParsePublicKey(credential.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePublicKey() error = %v", err)
+	}
+
+	// Each sign-in reports a higher counter, which becomes the stored one
+	signCount := credential.SignCount
+	for range 2 {
+		challenge := make([]byte, 32)
+		rand.Read(challenge)
+
+		assertion, err := rp.VerifyAssertion(authenticator.assert(t, challenge), challenge, key, signCount)
+		if err != nil {
+			t.Fatalf("VerifyAssertion() error = %v", err)
+		}
+		if assertion.SignCount != authenticator.signCount || !assertion.UserVerified {
+			t.Errorf("assertion = %+v", assertion)
+		}
+		signCount = assertion.SignCount
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(a *testAuthenticator)
+		resp    func(resp *RegistrationResponse)
+		wantErr error
+	}{
+		{name: "wrong origin", modify: func(a *testAuthenticator) { a.origin = "https://evil.example.net" }, wantErr: ErrOrigin},
+		{name: "wrong rpIdHash", modify: func(a *testAuthenticator) { a.rpID = "evil.example.net" }, wantErr: ErrRPID},
+		{name: "user not present", modify: func(a *testAuthenticator) { a.flags &^= flagUserPresent }, wantErr: ErrUserPresence},
+		{name: "sign-in response", modify: func(a *testAuthenticator) { a.ceremony = "webauthn.get" }, wantErr: ErrInvalidResponse},
+		{name: "other credential ID", resp: func(r *RegistrationResponse) { r.RawID = []byte("another credential") }, wantErr: ErrInvalidResponse},
+		{name: "another challenge", resp: func(r *RegistrationResponse) {
+			r.Response.ClientDataJSON = bytes.Replace(r.Response.ClientDataJSON, []byte(`"challenge":"M`), []byte(`"challenge":"N`), 1)
+		}, wantErr: ErrChallenge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := newTestAuthenticator(t)
+			if tt.modify != nil {
+				tt.modify(authenticator)
+			}
+			resp := authenticator.register(testChallenge)
+			if tt.resp != nil {
+				tt.resp(resp)
+			}
+
+			if _, err := testRelyingParty().VerifyRegistration(resp, testChallenge); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyRegistration() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(a *testAuthenticator)
+		resp      func(resp *AssertionResponse)
+		signCount uint32 // Counter stored for the credential before the sign-in
+		wantErr   error
+	}{
+		{name: "wrong origin", modify: func(a *testAuthenticator) { a.origin = "https://evil.example.net" }, wantErr: ErrOrigin},
+		{name: "wrong rpIdHash", modify: func(a *testAuthenticator) { a.rpID = "evil.example.net" }, wantErr: ErrRPID},
+		{name: "user not present", modify: func(a *testAuthenticator) { a.flags &^= flagUserPresent }, wantErr: ErrUserPresence},
+		{name: "registration response", modify: func(a *testAuthenticator) { a.ceremony = "webauthn.create" }, wantErr: ErrInvalidResponse},
+		{name: "sign count repeated", signCount: 5, modify: func(a *testAuthenticator) { a.signCount = 4 }, wantErr: ErrSignCount},
+		{name: "sign count went backwards", signCount: 9, modify: func(a *testAuthenticator) { a.signCount = 4 }, wantErr: ErrSignCount},
+		{name: "counter dropped to zero", signCount: 9, modify: func(a *testAuthenticator) { a.signCount = ^uint32(0) }, wantErr: ErrSignCount},
+		{name: "tampered authenticator data", resp: func(r *AssertionResponse) { r.Response.AuthenticatorData[32] |= flagBackedUp }, wantErr: errSignature},
+		{name: "truncated authenticator data", resp: func(r *AssertionResponse) { r.Response.AuthenticatorData = r.Response.AuthenticatorData[:36] }, wantErr: ErrInvalidResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := newTestAuthenticator(t)
+			key, err := ParsePublicKey(authenticator.coseKey())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(authenticator)
+			}
+			resp := authenticator.assert(t, testChallenge)
+			if tt.resp != nil {
+				tt.resp(resp)
+			}
+
+			if _, err := testRelyingParty().VerifyAssertion(resp, testChallenge, key, tt.signCount); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyAssertion() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionWithoutCounter(t *testing.T) {
+	authenticator := newTestAuthenticator(t)
+	key, err := ParsePublicKey(authenticator.coseKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Authenticators without a counter report zero every time
+	authenticator.signCount = ^uint32(0)
+	if _, err := testRelyingParty().VerifyAssertion(authenticator.assert(t, testChallenge), testChallenge, key, 0); err != nil {
+		t.Errorf("VerifyAssertion() error = %v", err)
+	}
+}
+
+func TestVerifyRegistrationTruncatedAttestation(t *testing.T) {
+	rp := testRelyingParty()
+	resp := newTestAuthenticator(t).register(testChallenge)
+	attestation := resp.Response.AttestationObject
+
+	for n := range len(attestation) {
+		resp.Response.AttestationObject = attestation[:n]
+		if _, err := rp.VerifyRegistration(resp, testChallenge); err == nil {
+			t.Fatalf("VerifyRegistration() accepted the attestation object cut to %d of %d bytes", n, len(attestation))
+		}
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	nested := bytes.Repeat(cborHead(4, 1), maxCBORDepth+2)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated argument", []byte{2<<5 | 26, 0, 0}},
+		{"byte string longer than the input", append(cborHead(2, 1<<32), 1, 2, 3)},
+		{"text string longer than the input", append(cborHead(3, 100), "short"...)},
+		{"array longer than the input", append(cborHead(4, 1<<40), cborInt(1)...)},
+		{"map longer than the input", append(cborHead(5, 1<<62), cborInt(1)...)},
+		{"unsigned integer beyond int64", cborHead(0, 1<<63)},
+		{"negative integer beyond int64", cborHead(1, 1<<63)},
+		{"indefinite length array", []byte{4<<5 | 31, 0xff}},
+		{"reserved additional information", []byte{0<<5 | 28}},
+		{"map keyed by bytes", cborMap(cborBytes([]byte{1}), cborInt(1))},
+		{"nested beyond the depth limit", append(nested, cborInt(0)...)},
+		{"float", []byte{7<<5 | 25, 0x3c, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if item, _, err := decodeCBOR(tt.data); !errors.Is(err, errCBOR) {
+				t.Errorf("decodeCBOR() = %v, %v, want %v", item, err, errCBOR)
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	x := make([]byte, 32)
+	x[31] = 1
+
+	tests := []struct {
+		name string
+		cose []byte
+	}{
+		{"not a map", cborBytes([]byte{1, 2, 3})},
+		{"unsupported algorithm", cborMap(cborInt(coseKty), cborInt(ktyEC2), cborInt(coseAlg), cborInt(-35))},
+		{"point off the curve", cborMap(
+			cborInt(coseKty), cborInt(ktyEC2), cborInt(coseAlg), cborInt(AlgES256), cborInt(coseCrv), cborInt(crvP256),
+			cborInt(coseX), cborBytes(x), cborInt(coseY), cborBytes(x),
+		)},
+		{"short coordinates", cborMap(
+			cborInt(coseKty), cborInt(ktyEC2), cborInt(coseAlg), cborInt(AlgES256), cborInt(coseCrv), cborInt(crvP256),
+			cborInt(coseX), cborBytes(x[:31]), cborInt(coseY), cborBytes(x),
+		)},
+		{"small RSA modulus", cborMap(
+			cborInt(coseKty), cborInt(ktyRSA), cborInt(coseAlg), cborInt(AlgRS256),
+			cborInt(coseCrv), cborBytes(make([]byte, 128)), cborInt(coseX), cborBytes([]byte{1, 0, 1}),
+		)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePublicKey(tt.cose); err == nil {
+				t.Error("ParsePublicKey() accepted the key")
+			}
+		})
+	}
+}
@@ -6,6 +6,10 @@ import Dashboard from '../views/Dashboard.vue'
 import Login from '../views/Login.vue'
 import Register from '../views/Register.vue'
 import ResetPassword from '../views/ResetPassword.vue'
+import OAuthCallback from '../views/OAuthCallback.vue'
+import MFAVerify from '../views/MFAVerify.vue'
+import ChangePassword from '../views/ChangePassword.vue'
+import VerifyEmail from '../views/VerifyEmail.vue'
 import Users from '../views/Users.vue'
 import UserForm from '../views/UserForm.vue'
 
@@ -25,6 +29,25 @@ const routes = [
     component: ResetPassword,
     meta: { requiresGuest: true }
   },
+  { 
+    path: '/auth/callback', 
+    component: OAuthCallback,
+    meta: { requiresGuest: true }
+  },
+  { 
+    path: '/mfa', 
+    component: MFAVerify,
+    meta: { requiresGuest: true }
+  },
+  { 
+    path: '/change-password', 
+    component: ChangePassword,
+    meta: { requiresGuest: true }
+  },
+  { 
+    path: '/verify-email', 
+    component: VerifyEmail
+  },
   { 
     path: '/dashboard', 
     component: Dashboard, 
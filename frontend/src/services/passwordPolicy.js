@@ -0,0 +1,35 @@
+// Client-side checks mirroring the server's password policy; the server has the final say
+export const passwordPolicyRules = (policy) => {
+  const minLength = policy?.min_length || 8
+  const rules = [
+    v => !!v || 'Password is required',
+    v => v.length >= minLength || `Password must be at least ${minLength} characters`
+  ]
+  
+  if (policy?.max_length) {
+    rules.push(v => v.length <= policy.max_length || `Password must be at most ${policy.max_length} characters`)
+  }
+  if (policy?.require_uppercase) {
+    rules.push(v => /\p{Lu}/u.test(v) || 'Password must contain an uppercase letter')
+  }
+  if (policy?.require_lowercase) {
+    rules.push(v => /\p{Ll}/u.test(v) || 'Password must contain a lowercase letter')
+  }
+  if (policy?.require_digit) {
+    rules.push(v => /\p{Nd}/u.test(v) || 'Password must contain a digit')
+  }
+  if (policy?.require_symbol) {
+    rules.push(v => /[^\p{L}\p{Nd}]/u.test(v) || 'Password must contain a symbol')
+  }
+  
+  return rules
+}
+
+// Describe a refused password with the message of every rule it broke
+export const passwordErrorMessage = (error, fallback) => {
+  const violations = error.response?.data?.violations
+  if (violations?.length) {
+    return violations.map(violation => violation.message).join(' ')
+  }
+  return error.response?.data?.error || fallback
+}
@@ -0,0 +1,63 @@
+// Converts WebAuthn options and credentials between the API's base64url JSON and the browser's ArrayBuffers
+
+const toBuffer = (value) => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+  const binary = atob(base64.padEnd(base64.length + (4 - base64.length % 4) % 4, '='))
+  return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer
+}
+
+const toBase64URL = (buffer) => {
+  if (!buffer) return null
+  const binary = String.fromCharCode(...new Uint8Array(buffer))
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+const toDescriptors = (list = []) => list.map(c => ({ ...c, id: toBuffer(c.id) }))
+
+export const isPasskeySupported = () => !!window.PublicKeyCredential
+
+// Runs navigator.credentials.create with options from /me/passkeys/options
+export const createPasskey = async (options) => {
+  const credential = await navigator.credentials.create({
+    publicKey: {
+      ...options,
+      challenge: toBuffer(options.challenge),
+      user: { ...options.user, id: toBuffer(options.user.id) },
+      excludeCredentials: toDescriptors(options.excludeCredentials)
+    }
+  })
+
+  return {
+    id: credential.id,
+    rawId: toBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+      attestationObject: toBase64URL(credential.response.attestationObject),
+      transports: credential.response.getTransports?.() || []
+    }
+  }
+}
+
+// Runs navigator.credentials.get with options from /auth/passkey/options
+export const getPasskey = async (options) => {
+  const credential = await navigator.credentials.get({
+    publicKey: {
+      ...options,
+      challenge: toBuffer(options.challenge),
+      allowCredentials: toDescriptors(options.allowCredentials)
+    }
+  })
+
+  return {
+    id: credential.id,
+    rawId: toBase64URL(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+      authenticatorData: toBase64URL(credential.response.authenticatorData),
+      signature: toBase64URL(credential.response.signature),
+      userHandle: toBase64URL(credential.response.userHandle)
+    }
+  }
+}
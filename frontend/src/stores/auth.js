@@ -2,6 +2,7 @@ import { defineStore } from 'pinia'
 import axios from 'axios'
 import { ref, computed } from 'vue'
 import { jwtDecode } from 'jwt-decode'
+import { createPasskey, getPasskey } from '@/services/webauthn'
 
 const BASE_URL = 'http://localhost:8080/api/v1'
 
@@ -11,6 +12,10 @@ export const useAuthStore = defineStore('auth', () => {
   const accessToken = ref(localStorage.getItem('accessToken') || null)
   const refreshToken = ref(localStorage.getItem('refreshToken') || null)
   const loading = ref(false)
+  const mfaChallenge = ref(null) // Pending sign-in waiting for a second factor
+  const emailVerificationPending = ref(false) // Registered, but sign-in waits for the email to be verified
+  const passwordChange = ref(null) // Pending sign-in whose expired password must be replaced first
+  const passwordPolicy = ref(null) // Rules new passwords must satisfy, loaded on demand
   
   // Getters
   const isAuthenticated = computed(() => {
@@ -55,18 +60,33 @@ export const useAuthStore = defineStore('auth', () => {
     setAuthHeader()
   }
   
+  // Keep the tokens, or the challenge when the sign-in needs a second factor
+  const handleAuthResponse = (data) => {
+    emailVerificationPending.value = !!data.email_verification_required
+    if (emailVerificationPending.value) {
+      return true
+    }
+    if (data.mfa_required) {
+      mfaChallenge.value = data
+      return true
+    }
+    if (data.access_token) {
+      mfaChallenge.value = null
+      storeTokens(data)
+      return true
+    }
+    return false
+  }
+  
   const login = async (credentials) => {
     loading.value = true
     try {
       const response = await axios.post(`${BASE_URL}/auth/login`, credentials)
       
-      if (response.data.access_token) {
-        storeTokens(response.data)
-        return true
-      }
-      return false
+      return handleAuthResponse(response.data)
     } catch (error) {
       console.error('Login error:', error)
+      passwordChange.value = error.response?.data?.password_expired ? error.response.data : null
       throw error
     } finally {
       loading.value = false
@@ -78,11 +98,7 @@ export const useAuthStore = defineStore('auth', () => {
     try {
       const response = await axios.post(`${BASE_URL}/auth/google`, { id_token: idToken })
       
-      if (response.data.access_token) {
-        storeTokens(response.data)
-        return true
-      }
-      return false
+      return handleAuthResponse(response.data)
     } catch (error) {
       console.error('Google login error:', error)
       throw error
@@ -91,16 +107,128 @@ export const useAuthStore = defineStore('auth', () => {
     }
   }
   
+  const exchangeLoginCode = async (code) => {
+    loading.value = true
+    try {
+      const response = await axios.post(`${BASE_URL}/auth/oidc/exchange`, { code })
+      
+      return handleAuthResponse(response.data)
+    } catch (error) {
+      console.error('Login code exchange error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  const loginWithPasskey = async (email) => {
+    loading.value = true
+    try {
+      const options = await axios.post(`${BASE_URL}/auth/passkey/options`, email ? { email } : {})
+      const { ceremony, publicKey } = options.data.data
+      const credential = await getPasskey(publicKey)
+      const response = await axios.post(`${BASE_URL}/auth/passkey/login`, { ceremony, credential })
+      
+      return handleAuthResponse(response.data)
+    } catch (error) {
+      console.error('Passkey login error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  // stepUp carries the current_password, code or recovery_code that confirms the account holder is present
+  const registerPasskey = async (name, stepUp = {}) => {
+    loading.value = true
+    try {
+      const options = await axios.post(`${BASE_URL}/me/passkeys/options`)
+      const { ceremony, publicKey } = options.data.data
+      const credential = await createPasskey(publicKey)
+      const response = await axios.post(`${BASE_URL}/me/passkeys`, { ...stepUp, ceremony, name, credential })
+      
+      return response.data.data
+    } catch (error) {
+      console.error('Passkey registration error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  const enrollMFA = async () => {
+    loading.value = true
+    try {
+      const response = await axios.post(`${BASE_URL}/auth/mfa/enroll`, {
+        mfa_token: mfaChallenge.value.mfa_token
+      })
+      return response.data.data
+    } catch (error) {
+      console.error('MFA enrollment error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  // Complete the pending sign-in; returns the recovery codes issued when an app was just set up
+  const verifyMFA = async ({ code, recoveryCode }) => {
+    loading.value = true
+    try {
+      const response = await axios.post(`${BASE_URL}/auth/mfa/verify`, {
+        mfa_token: mfaChallenge.value.mfa_token,
+        code,
+        recovery_code: recoveryCode
+      })
+      
+      mfaChallenge.value = null
+      storeTokens(response.data)
+      return response.data.recovery_codes || []
+    } catch (error) {
+      console.error('MFA verification error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  // Replace the expired password and finish the pending sign-in
+  const changeExpiredPassword = async (newPassword) => {
+    loading.value = true
+    try {
+      const response = await axios.post(`${BASE_URL}/auth/change-password`, {
+        password_change_token: passwordChange.value.password_change_token,
+        new_password: newPassword
+      })
+      
+      passwordChange.value = null
+      return handleAuthResponse(response.data)
+    } catch (error) {
+      console.error('Password change error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  const fetchPasswordPolicy = async () => {
+    if (passwordPolicy.value) return passwordPolicy.value
+    
+    try {
+      const response = await axios.get(`${BASE_URL}/auth/password-policy`)
+      passwordPolicy.value = response.data.data
+    } catch (error) {
+      console.error('Password policy error:', error)
+    }
+    return passwordPolicy.value
+  }
+  
   const register = async (userData) => {
     loading.value = true
     try {
       const response = await axios.post(`${BASE_URL}/auth/register`, userData)
       
-      if (response.data.access_token) {
-        storeTokens(response.data)
-        return true
-      }
-      return false
+      return handleAuthResponse(response.data)
     } catch (error) {
       console.error('Registration error:', error)
       throw error
@@ -109,6 +237,32 @@ export const useAuthStore = defineStore('auth', () => {
     }
   }
   
+  const verifyEmail = async (token) => {
+    loading.value = true
+    try {
+      await axios.post(`${BASE_URL}/auth/verify-email`, { token })
+      return true
+    } catch (error) {
+      console.error('Email verification error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
+  const resendVerification = async (email) => {
+    loading.value = true
+    try {
+      await axios.post(`${BASE_URL}/auth/resend-verification`, { email })
+      return true
+    } catch (error) {
+      console.error('Resend verification error:', error)
+      throw error
+    } finally {
+      loading.value = false
+    }
+  }
+  
   const refreshSession = async () => {
     if (!refreshToken.value) return false
     
@@ -193,11 +347,24 @@ export const useAuthStore = defineStore('auth', () => {
     user,
     accessToken,
     loading,
+    mfaChallenge,
+    emailVerificationPending,
+    passwordChange,
+    passwordPolicy,
     isAuthenticated,
     userRoles,
     login,
     loginWithGoogle,
+    exchangeLoginCode,
+    loginWithPasskey,
+    registerPasskey,
+    enrollMFA,
+    verifyMFA,
+    changeExpiredPassword,
+    fetchPasswordPolicy,
     register,
+    verifyEmail,
+    resendVerification,
     refreshSession,
     logout,
     forgotPassword,